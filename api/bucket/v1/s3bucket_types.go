@@ -24,12 +24,417 @@ import (
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // S3BucketSpec defines the desired state of S3Bucket
+// +kubebuilder:validation:XValidation:rule="!has(self.replication) || !has(self.versioning) || self.versioning == 'Enabled'",message="replication requires versioning Enabled"
+// +kubebuilder:validation:XValidation:rule="has(self.providerConfigRef) == has(oldSelf.providerConfigRef) && (!has(self.providerConfigRef) || self.providerConfigRef == oldSelf.providerConfigRef)",message="providerConfigRef is immutable"
+// +kubebuilder:validation:XValidation:rule="has(self.region) == has(oldSelf.region) && (!has(self.region) || self.region == oldSelf.region)",message="region is immutable"
 type S3BucketSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Phase describes the desired state of the S3bucket (online, offline)
+	// Phase describes the desired state of the S3bucket (online, offline).
+	// Offline S3buckets are taken out of service with a deny-all bucket policy, their data is kept.
 	Phase BucketPhase `json:"phase,omitempty"`
+
+	// DeletionPolicy describes what happens to the S3bucket when the S3Bucket is deleted (delete, retain, orphan).
+	// Defaults to Delete.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// ForceDestroy empties the S3bucket of all objects, versions, delete markers and multipart uploads
+	// before deleting it. Only used with the Delete deletion policy.
+	ForceDestroy bool `json:"forceDestroy,omitempty"`
+
+	// Versioning describes the desired versioning state of the S3bucket (enabled, suspended).
+	// Versioning is not managed when empty.
+	Versioning VersioningState `json:"versioning,omitempty"`
+
+	// Encryption describes the default server-side encryption of the S3bucket.
+	// Defaults to SSE-S3 (AES256) when empty.
+	Encryption *BucketEncryption `json:"encryption,omitempty"`
+
+	// LifecycleRules describe the lifecycle configuration of the S3bucket.
+	// Lifecycle rules are not managed when empty, removing them deletes the lifecycle configuration applied by the operator.
+	// +listType=map
+	// +listMapKey=id
+	LifecycleRules []LifecycleRule `json:"lifecycleRules,omitempty"`
+
+	// Tags are applied to the S3bucket together with the tags reserved by the operator.
+	// Tags using a reserved key are ignored, other tags set outside of the operator are removed.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Policy describes the bucket policy of the S3bucket, either as raw JSON or as structured grants.
+	// The bucket policy is not managed when empty, an empty policy block removes the bucket policy.
+	Policy *BucketPolicy `json:"policy,omitempty"`
+
+	// PublicAccessBlock describes which public access to the S3bucket is blocked.
+	// All four blocks default to on.
+	PublicAccessBlock *PublicAccessBlock `json:"publicAccessBlock,omitempty"`
+
+	// CORSRules describe the CORS configuration of the S3bucket, CORS is disabled when empty
+	CORSRules []CORSRule `json:"cors,omitempty"`
+
+	// Website configures static website hosting of the S3bucket, website hosting is disabled when empty
+	Website *BucketWebsite `json:"website,omitempty"`
+
+	// Logging configures server access logging of the S3bucket, access logging is not managed when empty
+	Logging *BucketLogging `json:"logging,omitempty"`
+
+	// ObjectLock configures Object Lock (WORM) of the S3bucket, Object Lock is not managed when empty.
+	// Object Lock can only be enabled when the S3bucket is created and cannot be disabled.
+	ObjectLock *ObjectLock `json:"objectLock,omitempty"`
+
+	// Replication configures replication of the objects of the S3bucket to other S3Buckets, replication is not managed when empty.
+	// Versioning is enabled on the S3bucket and its destinations.
+	Replication *BucketReplication `json:"replication,omitempty"`
+
+	// Notifications send events of the S3bucket to queues, topics and functions.
+	// Notifications are not managed when empty, removing them clears the notifications applied by the operator.
+	// +listType=map
+	// +listMapKey=id
+	Notifications []BucketNotification `json:"notifications,omitempty"`
+
+	// ProviderConfigRef is the name of the S3ProviderConfig the S3bucket is managed with, the operator defaults when empty.
+	// It is immutable, the s3 bucket can't move to another provider.
+	ProviderConfigRef string `json:"providerConfigRef,omitempty"`
+
+	// Region the S3bucket is created in (ex: eu-central-1), the region of the S3 client when empty.
+	// An existing S3bucket in another region is reported, it is never moved.
+	// It is immutable, the s3 bucket can't move to another region.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9-]+$`
+	Region string `json:"region,omitempty"`
+}
+
+// BucketEncryption describes the default server-side encryption of an S3bucket
+type BucketEncryption struct {
+	// Algorithm is the server-side encryption algorithm (AES256, aws:kms). Defaults to AES256.
+	Algorithm EncryptionAlgorithm `json:"algorithm,omitempty"`
+
+	// KMSKeyID is the ID or ARN of the KMS key used by the aws:kms algorithm.
+	// The AWS managed key is used when neither KMSKeyID nor KMSKeyRef is set.
+	KMSKeyID string `json:"kmsKeyID,omitempty"`
+
+	// KMSKeyRef references the Secret or ConfigMap key holding the ID or ARN of the KMS key, used when KMSKeyID is empty
+	KMSKeyRef *ValueReference `json:"kmsKeyRef,omitempty"`
+
+	// BucketKeyEnabled reduces the cost of aws:kms encryption by using an S3 bucket key
+	BucketKeyEnabled bool `json:"bucketKeyEnabled,omitempty"`
+}
+
+// ValueReference references a key of a Secret or ConfigMap in the namespace of the S3Bucket
+type ValueReference struct {
+	// Kind is the kind of the referenced object (Secret, ConfigMap)
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	Kind string `json:"kind"`
+
+	// Name is the name of the referenced object
+	Name string `json:"name"`
+
+	// Key is the key of the value in the referenced object
+	Key string `json:"key"`
+}
+
+// LifecycleRule describes a lifecycle rule of an S3bucket.
+// A rule applies to the objects matching both its prefix and tags.
+type LifecycleRule struct {
+	// ID uniquely identifies the rule
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=255
+	ID string `json:"id"`
+
+	// Disabled keeps the rule without applying it
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Prefix filters the objects the rule applies to by key prefix
+	Prefix string `json:"prefix,omitempty"`
+
+	// Tags filters the objects the rule applies to by object tags
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// ExpirationDays is the number of days after creation when objects expire
+	// +kubebuilder:validation:Minimum=1
+	ExpirationDays int64 `json:"expirationDays,omitempty"`
+
+	// NoncurrentVersionExpirationDays is the number of days after becoming noncurrent when object versions expire
+	// +kubebuilder:validation:Minimum=1
+	NoncurrentVersionExpirationDays int64 `json:"noncurrentVersionExpirationDays,omitempty"`
+
+	// Transitions move objects to other storage classes
+	Transitions []LifecycleTransition `json:"transitions,omitempty"`
+
+	// AbortIncompleteMultipartUploadDays is the number of days after initiation when incomplete multipart uploads are aborted
+	// +kubebuilder:validation:Minimum=1
+	AbortIncompleteMultipartUploadDays int64 `json:"abortIncompleteMultipartUploadDays,omitempty"`
+}
+
+// LifecycleTransition moves objects to another storage class
+type LifecycleTransition struct {
+	// Days is the number of days after creation when objects are moved
+	// +kubebuilder:validation:Minimum=0
+	Days int64 `json:"days"`
+
+	// StorageClass is the storage class objects are moved to
+	// +kubebuilder:validation:Enum=GLACIER;STANDARD_IA;ONEZONE_IA;INTELLIGENT_TIERING;DEEP_ARCHIVE;GLACIER_IR
+	StorageClass string `json:"storageClass"`
+}
+
+// BucketPolicy describes the bucket policy of an S3bucket
+// +kubebuilder:validation:XValidation:rule="!(has(self.raw) && has(self.grants))",message="raw and grants are mutually exclusive"
+type BucketPolicy struct {
+	// Raw is the bucket policy as a JSON document
+	Raw string `json:"raw,omitempty"`
+
+	// Grants are rendered into the statements of the bucket policy
+	Grants []PolicyGrant `json:"grants,omitempty"`
+}
+
+// PolicyGrant grants (or denies) principals access to the objects of an S3bucket
+type PolicyGrant struct {
+	// Sid identifies the statements rendered for the grant
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9]*$`
+	Sid string `json:"sid,omitempty"`
+
+	// Effect of the grant (Allow, Deny). Defaults to Allow.
+	// +kubebuilder:validation:Enum=Allow;Deny
+	// +kubebuilder:default=Allow
+	Effect string `json:"effect,omitempty"`
+
+	// Principals are the AWS accounts, users or roles (IDs or ARNs) the grant applies to, "*" for everyone
+	// +kubebuilder:validation:MinItems=1
+	Principals []string `json:"principals"`
+
+	// Actions are access levels (read, write, delete, list) or S3 actions such as s3:GetObjectTagging
+	// +kubebuilder:validation:MinItems=1
+	Actions []string `json:"actions"`
+
+	// Prefix limits the grant to the object keys starting with the prefix
+	Prefix string `json:"prefix,omitempty"`
+
+	// Conditions are added to the rendered statements, by condition operator and condition key
+	Conditions map[string]map[string][]string `json:"conditions,omitempty"`
+}
+
+// PublicAccessBlock describes which public access to an S3bucket is blocked, every setting defaults to true
+type PublicAccessBlock struct {
+	// BlockPublicAcls rejects requests setting public ACLs on the S3bucket and its objects
+	BlockPublicAcls *bool `json:"blockPublicAcls,omitempty"`
+
+	// IgnorePublicAcls ignores public ACLs on the S3bucket and its objects
+	IgnorePublicAcls *bool `json:"ignorePublicAcls,omitempty"`
+
+	// BlockPublicPolicy rejects bucket policies granting public access
+	BlockPublicPolicy *bool `json:"blockPublicPolicy,omitempty"`
+
+	// RestrictPublicBuckets restricts access to an S3bucket with a public policy to AWS services and the bucket owner
+	RestrictPublicBuckets *bool `json:"restrictPublicBuckets,omitempty"`
+}
+
+// CORSRule allows cross-origin requests to an S3bucket, the first matching rule applies
+type CORSRule struct {
+	// ID identifies the rule
+	// +kubebuilder:validation:MaxLength=255
+	ID string `json:"id,omitempty"`
+
+	// AllowedOrigins are the origins allowed to make cross-origin requests, with at most one "*" wildcard each
+	// +kubebuilder:validation:MinItems=1
+	AllowedOrigins []string `json:"allowedOrigins"`
+
+	// AllowedMethods are the HTTP methods allowed for cross-origin requests
+	// +kubebuilder:validation:MinItems=1
+	AllowedMethods []CORSMethod `json:"allowedMethods"`
+
+	// AllowedHeaders are the headers allowed in preflight requests
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+
+	// ExposeHeaders are the response headers browsers may access
+	ExposeHeaders []string `json:"exposeHeaders,omitempty"`
+
+	// MaxAgeSeconds is the time browsers may cache the preflight response
+	// +kubebuilder:validation:Minimum=0
+	MaxAgeSeconds int64 `json:"maxAgeSeconds,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=GET;PUT;POST;DELETE;HEAD
+// HTTP methods allowed by CORS rules
+type CORSMethod string
+
+// BucketWebsite configures static website hosting of an S3bucket
+// +kubebuilder:validation:XValidation:rule="has(self.indexDocument) != has(self.redirectAllRequestsTo)",message="exactly one of indexDocument and redirectAllRequestsTo is required"
+type BucketWebsite struct {
+	// IndexDocument is appended to requests for a directory, e.g. index.html
+	IndexDocument string `json:"indexDocument,omitempty"`
+
+	// ErrorDocument is the key of the object returned on 4XX errors
+	ErrorDocument string `json:"errorDocument,omitempty"`
+
+	// RedirectAllRequestsTo redirects every request to another host instead of serving the objects
+	RedirectAllRequestsTo *WebsiteRedirect `json:"redirectAllRequestsTo,omitempty"`
+
+	// RoutingRules redirect the requests matching their condition, the first matching rule applies
+	RoutingRules []WebsiteRoutingRule `json:"routingRules,omitempty"`
+}
+
+// WebsiteRedirect redirects requests to another host
+type WebsiteRedirect struct {
+	// HostName is the host requests are redirected to
+	HostName string `json:"hostName"`
+
+	// Protocol of the redirect (http, https), defaults to the protocol of the request
+	// +kubebuilder:validation:Enum=http;https
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// WebsiteRoutingRule redirects the website requests matching its condition
+type WebsiteRoutingRule struct {
+	// Condition selects the requests the rule applies to, all requests when empty
+	Condition *RoutingRuleCondition `json:"condition,omitempty"`
+
+	// Redirect describes where the requests are redirected to
+	Redirect RoutingRuleRedirect `json:"redirect"`
+}
+
+// RoutingRuleCondition selects website requests by key prefix and/or returned error code
+type RoutingRuleCondition struct {
+	// KeyPrefixEquals matches requests for keys starting with the prefix
+	KeyPrefixEquals string `json:"keyPrefixEquals,omitempty"`
+
+	// HTTPErrorCodeReturnedEquals matches requests failing with the HTTP error code
+	HTTPErrorCodeReturnedEquals string `json:"httpErrorCodeReturnedEquals,omitempty"`
+}
+
+// RoutingRuleRedirect describes where the requests matching a routing rule are redirected to
+type RoutingRuleRedirect struct {
+	// HostName is the host requests are redirected to, defaults to the host of the request
+	HostName string `json:"hostName,omitempty"`
+
+	// Protocol of the redirect (http, https), defaults to the protocol of the request
+	// +kubebuilder:validation:Enum=http;https
+	Protocol string `json:"protocol,omitempty"`
+
+	// HTTPRedirectCode is the HTTP status code of the redirect, defaults to 301
+	HTTPRedirectCode string `json:"httpRedirectCode,omitempty"`
+
+	// ReplaceKeyPrefixWith replaces the prefix matched by KeyPrefixEquals, exclusive with ReplaceKeyWith
+	ReplaceKeyPrefixWith string `json:"replaceKeyPrefixWith,omitempty"`
+
+	// ReplaceKeyWith replaces the whole key of the request
+	ReplaceKeyWith string `json:"replaceKeyWith,omitempty"`
+}
+
+// BucketLogging configures server access logging of an S3bucket to a target bucket
+// +kubebuilder:validation:XValidation:rule="has(self.targetBucketRef) != has(self.targetBucket)",message="exactly one of targetBucketRef and targetBucket is required"
+type BucketLogging struct {
+	// TargetBucketRef is the name of the S3Bucket in the same namespace receiving the access logs.
+	// Access logging is enabled once the target S3Bucket is online.
+	TargetBucketRef string `json:"targetBucketRef,omitempty"`
+
+	// TargetBucket is the name of an s3 bucket, not managed by the operator, receiving the access logs
+	TargetBucket string `json:"targetBucket,omitempty"`
+
+	// TargetPrefix is prepended to the keys of the access log objects
+	TargetPrefix string `json:"targetPrefix,omitempty"`
+}
+
+// ObjectLock configures Object Lock of an S3bucket, preventing objects from being deleted or overwritten
+// +kubebuilder:validation:XValidation:rule="!has(self.defaultRetention) || self.enabled",message="defaultRetention requires enabled"
+type ObjectLock struct {
+	// Enabled enables Object Lock when the S3bucket is created, which also enables versioning
+	Enabled bool `json:"enabled"`
+
+	// DefaultRetention is applied to new objects, objects are not retained by default when empty
+	DefaultRetention *ObjectLockRetention `json:"defaultRetention,omitempty"`
+}
+
+// ObjectLockRetention describes how long and how strictly objects are retained
+// +kubebuilder:validation:XValidation:rule="has(self.days) != has(self.years)",message="exactly one of days and years is required"
+type ObjectLockRetention struct {
+	// Mode of the retention (GOVERNANCE, COMPLIANCE).
+	// COMPLIANCE retention cannot be shortened or bypassed by any user.
+	// +kubebuilder:validation:Enum=GOVERNANCE;COMPLIANCE
+	Mode string `json:"mode"`
+
+	// Days objects are retained for
+	// +kubebuilder:validation:Minimum=1
+	Days int64 `json:"days,omitempty"`
+
+	// Years objects are retained for
+	// +kubebuilder:validation:Minimum=1
+	Years int64 `json:"years,omitempty"`
+}
+
+// BucketReplication configures replication of the objects of an S3bucket
+type BucketReplication struct {
+	// RoleARN is the ARN of the IAM role S3 assumes to replicate the objects.
+	// The operator creates and manages a replication role when empty.
+	RoleARN string `json:"roleARN,omitempty"`
+
+	// Rules describe which objects are replicated where
+	// +kubebuilder:validation:MinItems=1
+	Rules []ReplicationRule `json:"rules"`
+}
+
+// ReplicationRule replicates the objects matching its prefix to a destination S3Bucket
+type ReplicationRule struct {
+	// ID uniquely identifies the rule
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=255
+	ID string `json:"id"`
+
+	// Priority decides which rule applies when rules overlap, higher wins. Defaults to the reversed position of the rule.
+	// +kubebuilder:validation:Minimum=0
+	Priority int64 `json:"priority,omitempty"`
+
+	// Disabled keeps the rule without applying it
+	Disabled bool `json:"disabled,omitempty"`
+
+	// DestinationRef is the name of the destination S3Bucket in the same namespace.
+	// The destination must be in the same AWS account, replication to other accounts is rejected.
+	DestinationRef string `json:"destinationRef"`
+
+	// Prefix filters the replicated objects by key prefix
+	Prefix string `json:"prefix,omitempty"`
+
+	// DeleteMarkerReplication replicates delete markers to the destination
+	DeleteMarkerReplication bool `json:"deleteMarkerReplication,omitempty"`
+
+	// StorageClass of the replicas, defaults to the storage class of the source objects
+	// +kubebuilder:validation:Enum=STANDARD;REDUCED_REDUNDANCY;STANDARD_IA;ONEZONE_IA;INTELLIGENT_TIERING;GLACIER;DEEP_ARCHIVE;GLACIER_IR
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// BucketNotification sends the events of an S3bucket matching its filters to one target
+// +kubebuilder:validation:XValidation:rule="(has(self.queueARN) ? 1 : 0) + (has(self.queueName) ? 1 : 0) + (has(self.topicARN) ? 1 : 0) + (has(self.lambdaFunctionARN) ? 1 : 0) == 1",message="exactly one of queueARN, queueName, topicARN and lambdaFunctionARN is required"
+type BucketNotification struct {
+	// ID uniquely identifies the notification
+	// +kubebuilder:validation:MinLength=1
+	ID string `json:"id"`
+
+	// Events are the S3 event types sent to the target, e.g. s3:ObjectCreated:*
+	// +kubebuilder:validation:MinItems=1
+	Events []string `json:"events"`
+
+	// Prefix filters the events by object key prefix
+	Prefix string `json:"prefix,omitempty"`
+
+	// Suffix filters the events by object key suffix
+	Suffix string `json:"suffix,omitempty"`
+
+	// QueueARN is the ARN of the SQS queue receiving the events
+	QueueARN string `json:"queueARN,omitempty"`
+
+	// QueueName is the name of the SQS queue receiving the events, resolved to its ARN by the operator
+	QueueName string `json:"queueName,omitempty"`
+
+	// TopicARN is the ARN of the SNS topic receiving the events
+	TopicARN string `json:"topicARN,omitempty"`
+
+	// LambdaFunctionARN is the ARN of the Lambda function receiving the events
+	LambdaFunctionARN string `json:"lambdaFunctionARN,omitempty"`
+}
+
+// EncryptionStatus is the observed default server-side encryption of an S3bucket
+type EncryptionStatus struct {
+	Algorithm        string `json:"algorithm,omitempty"`
+	KMSKeyID         string `json:"kmsKeyID,omitempty"`
+	BucketKeyEnabled bool   `json:"bucketKeyEnabled,omitempty"`
 }
 
 // S3BucketStatus defines the observed state of S3Bucket
@@ -37,12 +442,63 @@ type S3BucketStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Phase describes the current state of the S3bucket (online, offline, pending)
+	// Phase describes the current state of the S3bucket (online, offline, pending, deleting)
 	Phase BucketPhase `json:"phase,omitempty"`
+
+	// Message describes the last error encountered while reconciling the S3bucket
+	Message string `json:"message,omitempty"`
+
+	// ObjectsDeleted is the number of objects, versions and delete markers removed while emptying the S3bucket
+	ObjectsDeleted int64 `json:"objectsDeleted,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the S3bucket was last reconciled to
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Versioning is the observed versioning state of the S3bucket
+	Versioning VersioningState `json:"versioning,omitempty"`
+
+	// Encryption is the observed default server-side encryption of the S3bucket
+	Encryption *EncryptionStatus `json:"encryption,omitempty"`
+
+	// WebsiteEndpoint is the endpoint of the static website hosted by the S3bucket, empty outside AWS
+	WebsiteEndpoint string `json:"websiteEndpoint,omitempty"`
+
+	// ObjectLockEnabled is whether Object Lock is enabled on the S3bucket
+	ObjectLockEnabled bool `json:"objectLockEnabled,omitempty"`
+
+	// ReplicationRoleARN is the ARN of the IAM role used to replicate the objects of the S3bucket
+	ReplicationRoleARN string `json:"replicationRoleARN,omitempty"`
+
+	// Region is the region the S3bucket lives in, as reported by S3
+	Region string `json:"region,omitempty"`
+
+	// LifecycleManaged is whether the lifecycle configuration of the S3bucket was applied by the operator
+	LifecycleManaged bool `json:"lifecycleManaged,omitempty"`
+
+	// NotificationsManaged is whether the notifications of the S3bucket were applied by the operator
+	NotificationsManaged bool `json:"notificationsManaged,omitempty"`
+
+	// PolicyManaged is whether the bucket policy of the S3bucket was applied by the operator
+	PolicyManaged bool `json:"policyManaged,omitempty"`
+
+	// LoggingTarget is the target bucket the operator granted log delivery on for the access logs of the S3bucket
+	LoggingTarget string `json:"loggingTarget,omitempty"`
+
+	// BucketCreated is whether the operator created the S3bucket, only such S3buckets are deleted with the S3Bucket
+	BucketCreated bool `json:"bucketCreated,omitempty"`
+
+	// Conditions describe the current state of the S3bucket (Ready, Synced, Deleting, Degraded)
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Region",type=string,JSONPath=`.status.region`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // S3Bucket is the Schema for the s3buckets API
 type S3Bucket struct {
@@ -62,14 +518,76 @@ type S3BucketList struct {
 	Items           []S3Bucket `json:"items"`
 }
 
-// +kubebuilder:validation:Enum=Offline;Online;Pending
+// +kubebuilder:validation:Enum=Offline;Online;Pending;Deleting
 // Phases for S3Bucket
 type BucketPhase string
 
 const (
-	PhaseOffline BucketPhase = "Offline"
-	PhaseOnline  BucketPhase = "Online"
-	PhasePending BucketPhase = "Pending"
+	PhaseOffline  BucketPhase = "Offline"
+	PhaseOnline   BucketPhase = "Online"
+	PhasePending  BucketPhase = "Pending"
+	PhaseDeleting BucketPhase = "Deleting"
+)
+
+// +kubebuilder:validation:Enum=Enabled;Suspended
+// Versioning states for S3Bucket
+type VersioningState string
+
+const (
+	VersioningEnabled   VersioningState = "Enabled"
+	VersioningSuspended VersioningState = "Suspended"
+)
+
+// +kubebuilder:validation:Enum=AES256;"aws:kms"
+// Server-side encryption algorithms for S3Bucket
+type EncryptionAlgorithm string
+
+const (
+	EncryptionAES256 EncryptionAlgorithm = "AES256"
+	EncryptionKMS    EncryptionAlgorithm = "aws:kms"
+)
+
+// PreOfflinePolicyAnnotation holds the bucket policy of an S3Bucket taken offline, restored when it goes back online.
+// Its presence marks the S3bucket as taken offline on purpose.
+const PreOfflinePolicyAnnotation = "bucket.my.domain/pre-offline-policy"
+
+// Tags the operator applies to every S3bucket, they cannot be set through spec.tags
+const (
+	// TagNamespace holds the namespace of the S3Bucket
+	TagNamespace = "bucket.my.domain/namespace"
+	// TagName holds the name of the S3Bucket
+	TagName = "bucket.my.domain/name"
+	// TagBucketGroup holds the name of the S3BucketGroup the S3Bucket belongs to, if any
+	TagBucketGroup = "bucket.my.domain/bucket-group"
+	// TagClusterID holds the ID of the cluster running the operator, if configured
+	TagClusterID = "bucket.my.domain/cluster-id"
+)
+
+// Condition types for S3Bucket
+const (
+	// ConditionReady indicates the S3bucket exists and reached its desired phase
+	ConditionReady = "Ready"
+	// ConditionSynced indicates the last reconcile of the S3bucket succeeded
+	ConditionSynced = "Synced"
+	// ConditionDeleting indicates the S3bucket is being deleted
+	ConditionDeleting = "Deleting"
+	// ConditionDegraded indicates the S3bucket was lost or can't be managed anymore
+	ConditionDegraded = "Degraded"
+	// ConditionDependenciesReady indicates the s3 buckets the S3bucket depends on are ready, e.g. its logging target
+	ConditionDependenciesReady = "DependenciesReady"
+)
+
+// +kubebuilder:validation:Enum=Delete;Retain;Orphan
+// Deletion policies for S3Bucket
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the S3bucket together with the S3Bucket
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the S3bucket and records it in an event
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyOrphan releases the S3bucket without touching or recording it
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
 )
 
 func init() {
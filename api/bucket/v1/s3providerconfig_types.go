@@ -0,0 +1,95 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// S3ProviderConfigSpec defines how the operator connects to an S3 account or S3 compatible store
+type S3ProviderConfigSpec struct {
+	// Endpoint of S3 and the other AWS services used by the operator, "aws" for the AWS endpoints.
+	// Defaults to LocalStack, like the settings of the operator.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Region of the S3 client, from the standard AWS configuration when empty
+	Region string `json:"region,omitempty"`
+
+	// ForcePathStyle addresses buckets as <endpoint>/<bucket> instead of <bucket>.<endpoint>, as needed by most S3 compatible stores.
+	// Defaults to true for LocalStack.
+	ForcePathStyle *bool `json:"forcePathStyle,omitempty"`
+
+	// CABundle is a PEM bundle of additional CAs trusted for the endpoint
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// InsecureSkipVerify disables the verification of the TLS certificate of the endpoint
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// CredentialsSecretRef references a Secret with the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optional AWS_SESSION_TOKEN keys.
+	// The standard AWS credentials chain of the operator is used when empty.
+	CredentialsSecretRef *SecretReference `json:"credentialsSecretRef,omitempty"`
+
+	// AssumeRoleARN is the ARN of an IAM role assumed with the credentials, e.g. to manage s3 buckets of another account
+	AssumeRoleARN string `json:"assumeRoleARN,omitempty"`
+
+	// ExternalID is passed when assuming the role, as required by the trust policy of some roles
+	ExternalID string `json:"externalID,omitempty"`
+}
+
+// SecretReference references a Secret in any namespace
+type SecretReference struct {
+	// Namespace of the Secret
+	Namespace string `json:"namespace"`
+
+	// Name of the Secret
+	Name string `json:"name"`
+}
+
+// S3ProviderConfigStatus defines the observed state of S3ProviderConfig
+type S3ProviderConfigStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.spec.endpoint`
+//+kubebuilder:printcolumn:name="Region",type=string,JSONPath=`.spec.region`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// S3ProviderConfig is the Schema for the s3providerconfigs API
+type S3ProviderConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   S3ProviderConfigSpec   `json:"spec,omitempty"`
+	Status S3ProviderConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// S3ProviderConfigList contains a list of S3ProviderConfig
+type S3ProviderConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []S3ProviderConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&S3ProviderConfig{}, &S3ProviderConfigList{})
+}
@@ -18,27 +18,115 @@ package v1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // S3BucketGroupSpec defines the desired state of S3BucketGroup
+// +kubebuilder:validation:XValidation:rule="has(self.providerConfigRef) == has(oldSelf.providerConfigRef) && (!has(self.providerConfigRef) || self.providerConfigRef == oldSelf.providerConfigRef)",message="providerConfigRef is immutable"
 type S3BucketGroupSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
 	DesiredBucketCount int `json:"desiredBucketCount,omitempty"`
+
+	// DeletionPolicy is the default deletion policy of the S3Buckets created for the S3BucketGroup
+	DeletionPolicy bucketv1.DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// ScaleDownPolicy decides which S3Buckets are removed first when the S3BucketGroup has more buckets than desired.
+	// Defaults to NewestFirst.
+	ScaleDownPolicy ScaleDownPolicy `json:"scaleDownPolicy,omitempty"`
+
+	// Naming describes how the names of the S3Buckets created for the S3BucketGroup are generated
+	Naming BucketNaming `json:"naming,omitempty"`
+
+	// Template describes the S3Buckets created for the S3BucketGroup.
+	// Changes to the template are rolled out to the existing S3Buckets.
+	Template S3BucketTemplate `json:"template,omitempty"`
+
+	// MaxUnavailable is the maximum number of S3Buckets that can be unready while a template change is rolled out.
+	// Value can be an absolute number (ex: 5) or a percentage of the desired bucket count (ex: 10%). Defaults to 1.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// ProviderConfigRef is the name of the S3ProviderConfig the S3BucketGroup checks bucket names with.
+	// It is the default providerConfigRef of the S3Buckets created for the S3BucketGroup, it is immutable.
+	ProviderConfigRef string `json:"providerConfigRef,omitempty"`
 }
 
+// S3BucketTemplate describes the S3Buckets created for a S3BucketGroup
+type S3BucketTemplate struct {
+	// Metadata holds the labels and annotations stamped onto every S3Bucket
+	Metadata S3BucketTemplateMeta `json:"metadata,omitempty"`
+
+	// Spec is the spec of every S3Bucket. Phase defaults to Online,
+	// DeletionPolicy and ProviderConfigRef default to those of the S3BucketGroup.
+	Spec bucketv1.S3BucketSpec `json:"spec,omitempty"`
+}
+
+// S3BucketTemplateMeta holds the metadata stamped onto the S3Buckets of a S3BucketGroup
+type S3BucketTemplateMeta struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// BucketNaming describes how the names of the S3Buckets in a S3BucketGroup are generated.
+// Generated names must follow the S3 bucket naming rules.
+type BucketNaming struct {
+	// Prefix is the prefix of the generated bucket names. Defaults to the S3BucketGroup name.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Template is a Go template rendering the bucket name from .Prefix, .Group, .Namespace, .Ordinal and .Suffix.
+	// It must use .Ordinal and one of .Suffix or .Namespace. Defaults to "{{.Prefix}}-{{.Ordinal}}-{{.Suffix}}".
+	Template string `json:"template,omitempty"`
+
+	// Suffix describes how .Suffix is generated (hash, random). Defaults to Hash, a hash of the namespace and group name.
+	Suffix NamingSuffix `json:"suffix,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Hash;Random
+// Suffixes for generated bucket names
+type NamingSuffix string
+
+const (
+	// NamingSuffixHash is a hash of the namespace and name of the S3BucketGroup
+	NamingSuffixHash NamingSuffix = "Hash"
+	// NamingSuffixRandom is a random string generated for every bucket
+	NamingSuffixRandom NamingSuffix = "Random"
+)
+
 // S3BucketGroupStatus defines the observed state of S3BucketGroup
 type S3BucketGroupStatus struct {
 	BucketCount int `json:"bucketCount,omitempty"`
+
+	// NextOrdinal is the ordinal used for the next generated bucket name
+	NextOrdinal int `json:"nextOrdinal,omitempty"`
+
+	// UpdatedBuckets is the number of S3Buckets matching the current template
+	UpdatedBuckets int `json:"updatedBuckets,omitempty"`
+
+	// ReadyBuckets is the number of S3Buckets that reached their desired phase for their current spec
+	ReadyBuckets int `json:"readyBuckets,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the S3BucketGroup was last reconciled to
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions describe the current state of the S3BucketGroup (Ready, Synced, Degraded)
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 	// Important: Run "make" to regenerate code after modifying this file
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.desiredBucketCount`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyBuckets`
+//+kubebuilder:printcolumn:name="Updated",type=integer,JSONPath=`.status.updatedBuckets`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // S3BucketGroup is the Schema for the s3bucketgroups API
 type S3BucketGroup struct {
@@ -58,6 +146,44 @@ type S3BucketGroupList struct {
 	Items           []S3BucketGroup `json:"items"`
 }
 
+// +kubebuilder:validation:Enum=NewestFirst;OldestFirst;EmptyFirst;AnnotatedFirst
+// Scale down policies for S3BucketGroup
+type ScaleDownPolicy string
+
+const (
+	// ScaleDownNewestFirst removes the most recently created S3Buckets first
+	ScaleDownNewestFirst ScaleDownPolicy = "NewestFirst"
+	// ScaleDownOldestFirst removes the least recently created S3Buckets first
+	ScaleDownOldestFirst ScaleDownPolicy = "OldestFirst"
+	// ScaleDownEmptyFirst removes S3Buckets without any objects first, then the newest ones
+	ScaleDownEmptyFirst ScaleDownPolicy = "EmptyFirst"
+	// ScaleDownAnnotatedFirst removes S3Buckets annotated with DeleteCandidateAnnotation first, then the newest ones
+	ScaleDownAnnotatedFirst ScaleDownPolicy = "AnnotatedFirst"
+)
+
+// Condition types for S3BucketGroup
+const (
+	// ConditionReady indicates all desired S3Buckets exist, match the template and are ready
+	ConditionReady = "Ready"
+	// ConditionSynced indicates the last reconcile of the S3BucketGroup succeeded
+	ConditionSynced = "Synced"
+	// ConditionDegraded indicates some S3Buckets of the S3BucketGroup are degraded or failing to sync
+	ConditionDegraded = "Degraded"
+)
+
+// BucketGroupNameLabel holds the name of the S3BucketGroup an S3Bucket belongs to
+const BucketGroupNameLabel = "bucketGroupName"
+
+// TemplateHashLabel holds the hash of the S3BucketGroup template an S3Bucket was last updated to
+const TemplateHashLabel = "bucketgroup.my.domain/template-hash"
+
+// AdoptAnnotation opts an S3Bucket labeled with BucketGroupNameLabel but created without an owner reference
+// into being adopted by its S3BucketGroup, other S3Buckets without an owner reference are left out of the group
+const AdoptAnnotation = "bucketgroup.my.domain/adopt"
+
+// DeleteCandidateAnnotation marks an S3Bucket to be removed first when its S3BucketGroup scales down
+const DeleteCandidateAnnotation = "bucketgroup.my.domain/delete-candidate"
+
 func init() {
 	SchemeBuilder.Register(&S3BucketGroup{}, &S3BucketGroupList{})
 }
@@ -1,26 +1,150 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"art-of-infrastructure-management/internal/s3config"
 )
 
 // Script to clear all of the existing s3 buckets from aws
 
+// finalizerTimeout is how long the finalizers of the S3Buckets get to delete their s3 buckets
+const finalizerTimeout = "2m"
+
+// awsCommand builds an aws cli command connecting to S3 with the same settings as the operator.
+// The addressing style is passed in the environment, see addressingStyleEnv.
+func awsCommand(config s3config.Config, env []string, args ...string) *exec.Cmd {
+	if !config.IsAWS() {
+		args = append(args, "--endpoint-url="+config.Endpoint)
+	}
+	if config.Region != "" {
+		args = append(args, "--region="+config.Region)
+	}
+	if config.CABundle != "" {
+		args = append(args, "--ca-bundle="+config.CABundle)
+	}
+	if config.InsecureSkipVerify {
+		args = append(args, "--no-verify-ssl")
+	}
+	command := exec.Command("aws", args...)
+	command.Env = append(os.Environ(), env...)
+	return command
+}
+
+// credentialsEnv returns the credentials of the credentials Secret as environment variables of the aws cli
+func credentialsEnv(config s3config.Config) ([]string, error) {
+	if config.CredentialsSecret == "" {
+		return nil, nil
+	}
+	reader, err := client.New(ctrl.GetConfigOrDie(), client.Options{})
+	if err != nil {
+		return nil, err
+	}
+	creds, err := config.Credentials(context.Background(), reader)
+	if err != nil {
+		return nil, err
+	}
+	value, err := creds.Get()
+	if err != nil {
+		return nil, err
+	}
+	env := []string{
+		s3config.AccessKeyIDKey + "=" + value.AccessKeyID,
+		s3config.SecretAccessKeyKey + "=" + value.SecretAccessKey,
+	}
+	if value.SessionToken != "" {
+		env = append(env, s3config.SessionTokenKey+"="+value.SessionToken)
+	}
+	return env, nil
+}
+
+// addressingStyleEnv points the aws cli to a config file with the addressing style of the config.
+// The aws cli only reads the addressing style from its config file, the returned function removes the file.
+func addressingStyleEnv(config s3config.Config) ([]string, func(), error) {
+	if config.ForcePathStyle == nil {
+		return nil, func() {}, nil
+	}
+	style := "virtual"
+	if *config.ForcePathStyle {
+		style = "path"
+	}
+	section := "default"
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		section = "profile " + profile
+	}
+	file, err := os.CreateTemp("", "aws-config")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() { os.Remove(file.Name()) }
+	_, err = fmt.Fprintf(file, "[%s]\ns3 =\n    addressing_style = %s\n", section, style)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return []string{"AWS_CONFIG_FILE=" + file.Name()}, remove, nil
+}
+
+// deleteAllBucketResources deletes the S3Bucket resources before the s3 buckets are deleted, so the operator and the
+// cleanup never delete the same s3 buckets at once. The finalizers get finalizerTimeout to delete the s3 buckets,
+// then the finalizers of the S3Buckets left (e.g. without a running operator) are removed.
 func deleteAllBucketResources() error {
-	command := exec.Command("kubectl", "delete", "--all", "s3bucket.bucket.my.domain")
-	_, err := command.Output()
+	command := exec.Command("kubectl", "delete", "--all", "s3bucket.bucket.my.domain", "--timeout="+finalizerTimeout)
+	if _, err := command.Output(); err == nil {
+		fmt.Println("All S3 bucket resources deleted")
+		return nil
+	}
+
+	// The S3Buckets left are being deleted, the operator no longer adds their finalizer back
+	fmt.Println("S3 bucket resources still being deleted, removing their finalizers")
+	listCommand := exec.Command("kubectl", "get", "s3bucket.bucket.my.domain", "-o", "name")
+	listOutput, err := listCommand.Output()
 	if err != nil {
-		fmt.Println("error listing s3 buckets: ", err)
+		fmt.Println("error listing s3 bucket resources: ", err)
 		return err
 	}
+	for _, name := range strings.Fields(string(listOutput)) {
+		patchCommand := exec.Command("kubectl", "patch", name, "--type=merge", "-p", `{"metadata":{"finalizers":null}}`)
+		if err := patchCommand.Run(); err != nil {
+			fmt.Printf("error removing the finalizers of %s: %v\n", name, err)
+		}
+	}
 	fmt.Println("All S3 bucket resources deleted")
 	return nil
 }
 
-func cleanup() error {
-	listBucketsCommand := exec.Command("aws", "s3", "ls", "--endpoint=http://localhost:4566")
+func cleanup(config s3config.Config) error {
+	err := deleteAllBucketResources()
+	if err != nil {
+		fmt.Println("failed to delete s3 bucket resources")
+		return err
+	}
+
+	env, err := credentialsEnv(config)
+	if err != nil {
+		fmt.Println("error loading s3 credentials: ", err)
+		return err
+	}
+	styleEnv, removeStyleEnv, err := addressingStyleEnv(config)
+	if err != nil {
+		fmt.Println("error writing the aws cli config: ", err)
+		return err
+	}
+	defer removeStyleEnv()
+	env = append(env, styleEnv...)
+
+	listBucketsCommand := awsCommand(config, env, "s3", "ls")
 	listOutputS3Buckets, err := listBucketsCommand.Output()
 	if err != nil {
 		fmt.Println("error listing s3 buckets: ", err)
@@ -32,7 +156,8 @@ func cleanup() error {
 		if bucketLine != "" {
 			bucketName := strings.Fields(bucketLine)[2]
 			fmt.Printf("deleting S3 bucket %s \n", bucketName)
-			deleteBucketCommand := exec.Command("aws", "s3", "rb", "s3://"+bucketName, "--endpoint=http://localhost:4566")
+			// --force deletes the objects in the bucket first, rb fails on non-empty buckets otherwise
+			deleteBucketCommand := awsCommand(config, env, "s3", "rb", "s3://"+bucketName, "--force")
 
 			err := deleteBucketCommand.Run()
 			if err != nil {
@@ -44,16 +169,27 @@ func cleanup() error {
 		}
 	}
 	fmt.Println("All S3 buckets deleted")
-
-	err = deleteAllBucketResources()
-	if err != nil {
-		fmt.Println("failed to delete s3 bucket resources")
-	}
 	return nil
 }
 
 func main() {
-	err := cleanup()
+	var deleteAllBuckets bool
+	flag.BoolVar(&deleteAllBuckets, "delete-all-buckets", false,
+		"Confirm the deletion of every s3 bucket of the account, required unless the endpoint is LocalStack.")
+	s3Options := s3config.Options{}
+	s3Options.BindFlags(flag.CommandLine)
+	flag.Parse()
+	config, err := s3Options.Load(flag.CommandLine)
+	if err != nil {
+		fmt.Println("error loading s3 settings: ", err)
+		return
+	}
+	if config.Endpoint != s3config.LocalStackEndpoint && !deleteAllBuckets {
+		fmt.Printf("refusing to delete every s3 bucket of %s, run again with --delete-all-buckets to confirm\n", config.Endpoint)
+		os.Exit(1)
+	}
+
+	err = cleanup(config)
 	if err != nil {
 		fmt.Println("error deleting existing aws s3 buckets")
 	}
@@ -17,15 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"os"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -39,6 +37,7 @@ import (
 	bucketgroupv1 "art-of-infrastructure-management/api/v1"
 	"art-of-infrastructure-management/internal/controller"
 	bucketcontroller "art-of-infrastructure-management/internal/controller/bucket"
+	"art-of-infrastructure-management/internal/s3config"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -59,33 +58,32 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var clusterID string
+	var enforcePublicAccessBlock bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8082", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&clusterID, "cluster-id", "", "The ID of the cluster, added to the tags of every S3 bucket.")
+	flag.BoolVar(&enforcePublicAccessBlock, "enforce-public-access-block", false,
+		"Keep all public access blocks of every S3 bucket on, ignoring S3Buckets that turn them off.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
+	s3Options := s3config.Options{}
+	s3Options.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	session, err := session.NewSession(&aws.Config{
-		Endpoint:         aws.String("http://localhost:4566"),
-		Region:           aws.String("us-west-1"),
-		S3ForcePathStyle: aws.Bool(true),
-	})
-
+	s3Config, err := s3Options.Load(flag.CommandLine)
 	if err != nil {
-		fmt.Println("Error creating an AWS session: ", err)
-		return
+		setupLog.Error(err, "unable to load the S3 settings")
+		os.Exit(1)
 	}
 
-	// Create S3 service client
-	svc := s3.New(session)
-
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -110,18 +108,39 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The cache isn't started yet, read the credentials Secret straight from the API server
+	creds, err := s3Config.Credentials(context.Background(), mgr.GetAPIReader())
+	if err != nil {
+		setupLog.Error(err, "unable to load the S3 credentials")
+		os.Exit(1)
+	}
+	session, err := s3Config.NewSession(creds)
+	if err != nil {
+		setupLog.Error(err, "unable to create an AWS session")
+		os.Exit(1)
+	}
+	setupLog.Info("connecting to S3", "endpoint", s3Config.Endpoint, "region", aws.StringValue(session.Config.Region))
+
+	// The default clients serve S3Buckets without S3ProviderConfig, the others are created on demand
+	// Secrets are read straight from the API server, caching them would watch every Secret of the cluster
+	clients := s3config.NewClientCache(mgr.GetClient(), mgr.GetAPIReader(), s3config.NewClients(session))
+
 	if err = (&controller.S3BucketGroupReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		S3Client: svc,
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Clients: clients,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "S3BucketGroup")
 		os.Exit(1)
 	}
 	if err = (&bucketcontroller.S3BucketReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		S3Client: svc,
+		Client:                   mgr.GetClient(),
+		Scheme:                   mgr.GetScheme(),
+		Clients:                  clients,
+		Recorder:                 mgr.GetEventRecorderFor("s3bucket-controller"),
+		APIReader:                mgr.GetAPIReader(),
+		ClusterID:                clusterID,
+		EnforcePublicAccessBlock: enforcePublicAccessBlock,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "S3Bucket")
 		os.Exit(1)
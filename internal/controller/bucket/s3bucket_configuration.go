@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// bucketConfigurator reconciles one part of the configuration of an existing S3 bucket with the S3Bucket spec.
+// Configurators record what they observe in the S3Bucket status, the caller persists it.
+type bucketConfigurator func(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error
+
+// bucketConfigurators are applied in order on every reconcile of an S3 bucket that reached its desired phase
+var bucketConfigurators = []bucketConfigurator{
+	reconcileVersioning,
+	reconcileReplication,
+	reconcileEncryption,
+	reconcileLifecycle,
+	reconcileTags,
+	reconcilePublicAccessBlock,
+	reconcilePolicy,
+	reconcileCORS,
+	reconcileWebsite,
+	reconcileLogging,
+	reconcileNotifications,
+	// Last, rejected Object Lock changes don't hold back the rest of the configuration
+	reconcileObjectLock,
+}
+
+// dependencyError is returned by configurators waiting for another S3Bucket, e.g. to become online
+type dependencyError struct {
+	reason  string
+	message string
+}
+
+func (e *dependencyError) Error() string {
+	return e.message
+}
+
+// hasDependencies checks whether the S3Bucket depends on other S3Buckets
+func hasDependencies(s3Bucket *bucketv1.S3Bucket) bool {
+	return (s3Bucket.Spec.Logging != nil && s3Bucket.Spec.Logging.TargetBucketRef != "") || s3Bucket.Spec.Replication != nil
+}
+
+// reconcileConfiguration applies all bucketConfigurators to the S3 bucket, stopping at the first error.
+// Configurators waiting for dependencies don't stop the others, they are reported in the DependenciesReady condition.
+func (r *S3BucketReconciler) reconcileConfiguration(ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	// The S3 bucket may live in another region than expected, e.g. when it was created outside of the operator
+	clients, err := reconcileRegion(ctx, clients, s3Bucket)
+	if err != nil {
+		return err
+	}
+
+	waiting := []*dependencyError{}
+	for _, configure := range bucketConfigurators {
+		err := configure(r, ctx, clients, s3Bucket)
+		var derr *dependencyError
+		if errors.As(err, &derr) {
+			waiting = append(waiting, derr)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case len(waiting) > 0:
+		messages := []string{}
+		for _, derr := range waiting {
+			messages = append(messages, derr.message)
+		}
+		setCondition(s3Bucket, bucketv1.ConditionDependenciesReady, metav1.ConditionFalse, waiting[0].reason, strings.Join(messages, "; "))
+	case hasDependencies(s3Bucket):
+		setCondition(s3Bucket, bucketv1.ConditionDependenciesReady, metav1.ConditionTrue, ReasonResolved, "")
+	default:
+		meta.RemoveStatusCondition(&s3Bucket.Status.Conditions, bucketv1.ConditionDependenciesReady)
+	}
+	return nil
+}
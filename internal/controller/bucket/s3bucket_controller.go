@@ -19,55 +19,104 @@ package bucket
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
 )
 
 // S3BucketReconciler reconciles a S3Bucket object
 type S3BucketReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
-	S3Client *s3.S3
+	Recorder record.EventRecorder
+
+	// APIReader reads the Secrets and ConfigMaps referenced by S3Buckets straight from the API server,
+	// so they aren't cached cluster-wide
+	APIReader client.Reader
+
+	// Clients hands out the AWS clients of the S3ProviderConfig of each S3Bucket
+	Clients *s3config.ClientCache
+
+	// ClusterID identifies the cluster in the tags of the S3 buckets, it is omitted when empty
+	ClusterID string
+
+	// EnforcePublicAccessBlock keeps all public access blocks on, regardless of the S3Bucket spec
+	EnforcePublicAccessBlock bool
 }
 
 var DefaultRequeueInterval = time.Second * 30
 
-// createS3Bucket creates a new S3 bucket with the given bucket name
-func createS3Bucket(svc *s3.S3, bucketName string) error {
-	_, err := svc.CreateBucket(&s3.CreateBucketInput{
-		Bucket: aws.String(bucketName),
-	})
+// defaultS3Region is the region of buckets created without location constraint
+const defaultS3Region = "us-east-1"
+
+// createS3Bucket creates a new S3 bucket for the S3Bucket in the region of the client.
+// Object Lock can only be enabled at this point, it is requested here when the spec enables it.
+func createS3Bucket(svc *s3.S3, s3Bucket *bucketv1.S3Bucket) error {
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(s3Bucket.Name),
+	}
+	// S3 rejects the location constraint of its default region
+	if region := aws.StringValue(svc.Config.Region); region != "" && region != defaultS3Region {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+	if objectLock := s3Bucket.Spec.ObjectLock; objectLock != nil && objectLock.Enabled {
+		input.ObjectLockEnabledForBucket = aws.Bool(true)
+	}
+	_, err := svc.CreateBucket(input)
 	if err != nil {
 		return err
 	}
 
-	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' created\n", bucketName)))
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' created\n", s3Bucket.Name)))
 	return nil
 }
 
-// GetBuckets retrieves the current number of S3 bucets in the S3BucketGroup
-func (r *S3BucketReconciler) BucketExists(s3Bucket *bucketv1.S3Bucket) bool {
-	result, err := r.S3Client.ListBuckets(&s3.ListBucketsInput{})
-	if err != nil {
-		log.Log.Error(err, colorCodeMessage("error listing S3 buckets"))
-		return false
+// BucketExists checks whether the S3 bucket of the S3Bucket exists.
+// Only a 404 answer means the S3 bucket is gone, other errors are returned to the caller.
+func (r *S3BucketReconciler) BucketExists(svc *s3.S3, s3Bucket *bucketv1.S3Bucket) (bool, error) {
+	_, err := svc.HeadBucket(&s3.HeadBucketInput{
+		Bucket: aws.String(s3Bucket.Name),
+	})
+	if err == nil || isRedirect(err) {
+		// A redirect means the S3 bucket exists in another region
+		return true, nil
 	}
-	for _, bucket := range result.Buckets {
-		if *bucket.Name == s3Bucket.Name {
-			return true
+	if aerr, ok := err.(awserr.RequestFailure); ok &&
+		(aerr.StatusCode() == http.StatusNotFound || aerr.Code() == s3.ErrCodeNoSuchBucket) {
+		return false, nil
+	}
+	return false, err
+}
+
+// checkBucketExists checks whether the S3 bucket of the S3Bucket exists, recording failed checks in status
+func (r *S3BucketReconciler) checkBucketExists(ctx context.Context, svc *s3.S3, s3Bucket *bucketv1.S3Bucket, original *bucketv1.S3BucketStatus) (bool, error) {
+	exists, err := r.BucketExists(svc, s3Bucket)
+	if err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to check if s3 bucket exists"))
+		setSyncError(s3Bucket, fmt.Errorf("failed to check if s3 bucket exists: %w", err), ReasonReconcileError)
+		if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
 		}
 	}
-	return false
+	return exists, err
 }
 
 func colorCodeMessage(message string) string {
@@ -79,6 +128,9 @@ func colorCodeMessage(message string) string {
 //+kubebuilder:rbac:groups=bucket.my.domain,resources=s3buckets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=bucket.my.domain,resources=s3buckets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=bucket.my.domain,resources=s3buckets/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=secrets;configmaps,verbs=get
+//+kubebuilder:rbac:groups=bucket.my.domain,resources=s3providerconfigs,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -102,35 +154,86 @@ func (r *S3BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return reconcile.Result{RequeueAfter: DefaultRequeueInterval}, err
 	}
 
+	// If the S3Bucket is being deleted, delete the backing s3 bucket before releasing it
+	if !s3Bucket.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, s3Bucket)
+	}
+
+	// Make sure the S3Bucket cannot be deleted without deleting the backing s3 bucket
+	if err := r.ensureFinalizer(ctx, s3Bucket); err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to add finalizer to s3Bucket"))
+		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+	}
+
 	log.Log.Info(colorCodeMessage(fmt.Sprintf("Reconciling s3Bucket %s", s3Bucket.Name)))
 	log.Log.Info(colorCodeMessage(fmt.Sprintf("Current Phase: %s, Desired Phase: %s", s3Bucket.Status.Phase, s3Bucket.Spec.Phase)))
 
-	// If S3Bucket no longer exists, update status.Phase = "offline"
-	if !r.BucketExists(s3Bucket) && s3Bucket.Status.Phase == bucketv1.PhaseOnline {
-		s3Bucket.Status.Phase = bucketv1.PhaseOffline
-		if err := r.Status().Update(ctx, s3Bucket); err != nil {
+	original := s3Bucket.Status.DeepCopy()
+	backfillBucketCreated(s3Bucket)
+
+	// Talk to S3 through the clients of the S3ProviderConfig of the S3Bucket, or the default ones without
+	clients, err := r.Clients.ForProvider(ctx, s3Bucket.Spec.ProviderConfigRef)
+	if err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to get the AWS clients of the s3Bucket"))
+		setSyncError(s3Bucket, err, ReasonProviderConfigError)
+		setCondition(s3Bucket, bucketv1.ConditionReady, metav1.ConditionFalse, ReasonProviderConfigError, err.Error())
+		if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
 			log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
-			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 		}
-		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, nil
+		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 	}
+	clients = regionalClients(clients, s3Bucket)
 
-	// If current phase = desired phase, skip reconcile
-	if s3Bucket.Spec.Phase == s3Bucket.Status.Phase {
-		log.Log.Info(colorCodeMessage("Skipping reconcile...Desired Phase == Current Phase"))
+	// If the s3 bucket no longer exists, update status.Phase = "offline" and report it as lost until it's back.
+	// Offline s3 buckets are checked too, there is no policy to freeze on a lost s3 bucket.
+	exists := false
+	if s3Bucket.Status.Phase == bucketv1.PhaseOnline || s3Bucket.Status.Phase == bucketv1.PhasePending ||
+		s3Bucket.Status.Phase == bucketv1.PhaseOffline {
+		if exists, err = r.checkBucketExists(ctx, clients.S3, s3Bucket, original); err != nil {
+			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+		}
+	}
+	if !exists && (s3Bucket.Status.Phase == bucketv1.PhaseOnline || s3Bucket.Status.Phase == bucketv1.PhaseOffline) {
+		if degraded := meta.FindStatusCondition(s3Bucket.Status.Conditions, bucketv1.ConditionDegraded); degraded == nil || degraded.Reason != ReasonBucketNotFound {
+			r.Recorder.Event(s3Bucket, corev1.EventTypeWarning, ReasonBucketNotFound, "S3 bucket no longer exists")
+		}
+		s3Bucket.Status.Phase = bucketv1.PhaseOffline
+		setCondition(s3Bucket, bucketv1.ConditionReady, metav1.ConditionFalse, ReasonBucketNotFound, "s3 bucket no longer exists")
+		setCondition(s3Bucket, bucketv1.ConditionDegraded, metav1.ConditionTrue, ReasonBucketNotFound, "s3 bucket no longer exists")
+		if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+		}
 		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, nil
 	}
 
-	// If spec.Phase = "online" and status.Phase = "", this is a newly created bucket
+	// If status.Phase = "", this is a newly created bucket
 	// Create a new s3 bucket and update status.Phase = "pending"
-	if s3Bucket.Spec.Phase == bucketv1.PhaseOnline && s3Bucket.Status.Phase == "" {
-		err := createS3Bucket(r.S3Client, s3Bucket.Name)
+	if s3Bucket.Status.Phase == "" && (s3Bucket.Spec.Phase == bucketv1.PhaseOnline || s3Bucket.Spec.Phase == bucketv1.PhaseOffline) {
+		// Never take over an existing s3 bucket, the finalizer would delete it with the S3Bucket
+		exists, err := r.checkBucketExists(ctx, clients.S3, s3Bucket, original)
+		if err != nil {
+			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+		}
+		if exists {
+			err = &reasonError{reason: ReasonBucketExists, err: fmt.Errorf("s3 bucket %s already exists and was not created by the operator", s3Bucket.Name)}
+		} else {
+			err = createS3Bucket(clients.S3, s3Bucket)
+		}
 		if err != nil {
 			log.Log.Error(err, colorCodeMessage("failed to create s3 bucket"))
+			setSyncError(s3Bucket, err, ReasonReconcileError)
+			setCondition(s3Bucket, bucketv1.ConditionReady, metav1.ConditionFalse, errorReason(err, ReasonReconcileError), err.Error())
+			if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+			}
 			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 		}
 		s3Bucket.Status.Phase = bucketv1.PhasePending
-		if err := r.Status().Update(ctx, s3Bucket); err != nil {
+		s3Bucket.Status.Region = clients.Region()
+		s3Bucket.Status.BucketCreated = true
+		setCondition(s3Bucket, bucketv1.ConditionReady, metav1.ConditionFalse, ReasonCreating, "s3 bucket is being created")
+		if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
 			log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
 			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 		}
@@ -138,15 +241,76 @@ func (r *S3BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 
 	// If S3Bucket was pending online status and is now online, update status.Phase = "online"
-	if s3Bucket.Status.Phase == bucketv1.PhasePending && r.BucketExists(s3Bucket) {
+	if s3Bucket.Status.Phase == bucketv1.PhasePending {
+		if !exists {
+			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, nil
+		}
 		s3Bucket.Status.Phase = bucketv1.PhaseOnline
-		if err := r.Status().Update(ctx, s3Bucket); err != nil {
+	}
+
+	// If spec.Phase = "offline", take the s3 bucket out of service without destroying data
+	if s3Bucket.Spec.Phase == bucketv1.PhaseOffline &&
+		(s3Bucket.Status.Phase == bucketv1.PhaseOnline || s3Bucket.Status.Phase == bucketv1.PhaseOffline) {
+		if err := r.takeBucketOffline(ctx, clients, s3Bucket); err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to take s3 bucket offline"))
+			setSyncError(s3Bucket, fmt.Errorf("failed to take s3 bucket offline: %w", err), ReasonReconcileError)
+			if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+			}
+			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+		}
+		if s3Bucket.Status.Phase != bucketv1.PhaseOffline {
+			r.Recorder.Event(s3Bucket, corev1.EventTypeNormal, "BucketOffline", "S3 bucket taken offline with a deny-all bucket policy")
+		}
+		s3Bucket.Status.Phase = bucketv1.PhaseOffline
+	}
+
+	// If spec.Phase = "online" and the s3 bucket was taken offline, restore its previous bucket policy
+	if s3Bucket.Spec.Phase == bucketv1.PhaseOnline && s3Bucket.Status.Phase == bucketv1.PhaseOffline && isBucketTakenOffline(s3Bucket) {
+		if err := r.bringBucketOnline(ctx, clients.S3, s3Bucket); err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to bring s3 bucket online"))
+			setSyncError(s3Bucket, fmt.Errorf("failed to bring s3 bucket online: %w", err), ReasonReconcileError)
+			if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+			}
+			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+		}
+		r.Recorder.Event(s3Bucket, corev1.EventTypeNormal, "BucketOnline", "S3 bucket brought back online, previous bucket policy restored")
+		s3Bucket.Status.Phase = bucketv1.PhaseOnline
+	}
+
+	// If current phase = desired phase, reconcile the configuration of the s3 bucket and record the reconciled generation
+	if s3Bucket.Spec.Phase == s3Bucket.Status.Phase {
+		reason := ReasonAvailable
+		if s3Bucket.Status.Phase == bucketv1.PhaseOffline {
+			reason = ReasonOffline
+		}
+		// Offline s3 buckets deny all but bucket policy requests, their configuration stays frozen
+		if s3Bucket.Status.Phase == bucketv1.PhaseOnline {
+			if err := r.reconcileConfiguration(ctx, clients, s3Bucket); err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to reconcile s3 bucket configuration"))
+				setSyncError(s3Bucket, err, ReasonReconcileError)
+				if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+					log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+				}
+				return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+			}
+		}
+		setSynced(s3Bucket)
+		setCondition(s3Bucket, bucketv1.ConditionReady, metav1.ConditionTrue, reason, "")
+		setCondition(s3Bucket, bucketv1.ConditionDegraded, metav1.ConditionFalse, ReasonHealthy, "")
+		if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
 			log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
 			return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 		}
+		log.Log.Info(colorCodeMessage("Desired Phase == Current Phase...configuration reconciled"))
 		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, nil
 	}
 
+	if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+	}
 	return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, nil
 }
 
@@ -0,0 +1,91 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+var _ = Describe("S3Bucket lost outside the operator", func() {
+	var (
+		ctx context.Context
+		s3  *fakeS3
+		r   *S3BucketReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		s3 = newFakeS3()
+		r = &S3BucketReconciler{
+			Client:    k8sClient,
+			Scheme:    scheme.Scheme,
+			Recorder:  record.NewFakeRecorder(100),
+			APIReader: k8sClient,
+			Clients:   s3config.NewClientCache(k8sClient, k8sClient, s3.clients()),
+		}
+	})
+
+	AfterEach(func() {
+		s3.close()
+	})
+
+	DescribeTable("reporting the lost s3 bucket as degraded",
+		func(name string, phase bucketv1.BucketPhase) {
+			s3Bucket := &bucketv1.S3Bucket{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Finalizers: []string{s3BucketFinalizer}},
+				Spec:       bucketv1.S3BucketSpec{Phase: phase, DeletionPolicy: bucketv1.DeletionPolicyOrphan},
+			}
+			Expect(k8sClient.Create(ctx, s3Bucket)).To(Succeed())
+			s3Bucket.Status = bucketv1.S3BucketStatus{Phase: phase, BucketCreated: true}
+			Expect(k8sClient.Status().Update(ctx, s3Bucket)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, s3Bucket)).To(Succeed())
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			// The s3 bucket stays reported as lost on every reconcile
+			for i := 0; i < 2; i++ {
+				_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, s3Bucket)).To(Succeed())
+				Expect(s3Bucket.Status.Phase).To(Equal(bucketv1.PhaseOffline))
+				degraded := meta.FindStatusCondition(s3Bucket.Status.Conditions, bucketv1.ConditionDegraded)
+				Expect(degraded).NotTo(BeNil())
+				Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+				Expect(degraded.Reason).To(Equal(ReasonBucketNotFound))
+				Expect(meta.IsStatusConditionFalse(s3Bucket.Status.Conditions, bucketv1.ConditionReady)).To(BeTrue())
+			}
+			Expect(r.Recorder.(*record.FakeRecorder).Events).To(HaveLen(1))
+		},
+		Entry("online", "lost-online", bucketv1.PhaseOnline),
+		Entry("offline", "lost-offline", bucketv1.PhaseOffline),
+	)
+})
@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoSuchCORSConfiguration is returned by GetBucketCors for buckets without CORS configuration
+const errCodeNoSuchCORSConfiguration = "NoSuchCORSConfiguration"
+
+// toS3CORSRule converts the CORS rule of the S3Bucket spec to an S3 CORS rule
+func toS3CORSRule(rule bucketv1.CORSRule) *s3.CORSRule {
+	s3Rule := &s3.CORSRule{
+		AllowedOrigins: aws.StringSlice(rule.AllowedOrigins),
+		AllowedHeaders: aws.StringSlice(rule.AllowedHeaders),
+		ExposeHeaders:  aws.StringSlice(rule.ExposeHeaders),
+	}
+	for _, method := range rule.AllowedMethods {
+		s3Rule.AllowedMethods = append(s3Rule.AllowedMethods, aws.String(string(method)))
+	}
+	if rule.ID != "" {
+		s3Rule.ID = aws.String(rule.ID)
+	}
+	if rule.MaxAgeSeconds > 0 {
+		s3Rule.MaxAgeSeconds = aws.Int64(rule.MaxAgeSeconds)
+	}
+	return s3Rule
+}
+
+// fromS3CORSRule converts an S3 CORS rule to the form of the S3Bucket spec, so both can be compared
+func fromS3CORSRule(s3Rule *s3.CORSRule) bucketv1.CORSRule {
+	rule := bucketv1.CORSRule{
+		ID:             aws.StringValue(s3Rule.ID),
+		AllowedOrigins: aws.StringValueSlice(s3Rule.AllowedOrigins),
+		AllowedHeaders: aws.StringValueSlice(s3Rule.AllowedHeaders),
+		ExposeHeaders:  aws.StringValueSlice(s3Rule.ExposeHeaders),
+		MaxAgeSeconds:  aws.Int64Value(s3Rule.MaxAgeSeconds),
+	}
+	for _, method := range s3Rule.AllowedMethods {
+		rule.AllowedMethods = append(rule.AllowedMethods, bucketv1.CORSMethod(aws.StringValue(method)))
+	}
+	return rule
+}
+
+// getBucketCORSRules retrieves the CORS rules of the S3 bucket, in order
+func getBucketCORSRules(svc *s3.S3, bucketName string) ([]bucketv1.CORSRule, error) {
+	result, err := svc.GetBucketCors(&s3.GetBucketCorsInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoSuchCORSConfiguration {
+			return nil, nil
+		}
+		return nil, err
+	}
+	rules := []bucketv1.CORSRule{}
+	for _, s3Rule := range result.CORSRules {
+		rules = append(rules, fromS3CORSRule(s3Rule))
+	}
+	return rules, nil
+}
+
+// reconcileCORS applies the desired CORS rules to the S3 bucket, reverting changes made outside of the operator.
+// CORS is removed from the S3 bucket when the S3Bucket has no CORS rules.
+func reconcileCORS(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	desired := s3Bucket.Spec.CORSRules
+	observed, err := getBucketCORSRules(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket CORS configuration: %w", err)
+	}
+	// Semantic equality treats nil and empty lists as equal
+	if equality.Semantic.DeepEqual(desired, observed) {
+		return nil
+	}
+
+	if len(desired) == 0 {
+		_, err = svc.DeleteBucketCors(&s3.DeleteBucketCorsInput{
+			Bucket: aws.String(s3Bucket.Name),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete bucket CORS configuration: %w", err)
+		}
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' CORS configuration removed\n", s3Bucket.Name)))
+		return nil
+	}
+
+	s3Rules := []*s3.CORSRule{}
+	for _, rule := range desired {
+		s3Rules = append(s3Rules, toS3CORSRule(rule))
+	}
+	_, err = svc.PutBucketCors(&s3.PutBucketCorsInput{
+		Bucket:            aws.String(s3Bucket.Name),
+		CORSConfiguration: &s3.CORSConfiguration{CORSRules: s3Rules},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket CORS configuration: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' CORS configuration updated with %d rules\n", s3Bucket.Name, len(s3Rules))))
+	return nil
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// s3BucketFinalizer keeps the S3Bucket object around until its backing S3 bucket has been deleted
+const s3BucketFinalizer = "bucket.my.domain/finalizer"
+
+// maxEmptyPagesPerReconcile is the number of object pages (1000 objects each) deleted per reconcile when force destroying
+const maxEmptyPagesPerReconcile = 5
+
+// emptyRequeueInterval is the delay between two batches when force destroying an S3 bucket
+var emptyRequeueInterval = time.Second
+
+// deleteS3Bucket deletes the S3 bucket with the given bucket name.
+// A bucket that no longer exists is treated as successfully deleted.
+func deleteS3Bucket(svc *s3.S3, bucketName string) error {
+	_, err := svc.DeleteBucket(&s3.DeleteBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchBucket {
+			log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' already deleted\n", bucketName)))
+			return nil
+		}
+		return err
+	}
+
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' deleted\n", bucketName)))
+	return nil
+}
+
+// emptyS3Bucket aborts the multipart uploads and deletes the objects, versions and delete markers of the
+// S3 bucket with the given bucket name. At most maxEmptyPagesPerReconcile pages are processed per call so
+// that very large buckets are emptied over several reconciles.
+// Returns the number of deleted objects and whether the S3 bucket is now empty.
+func emptyS3Bucket(svc *s3.S3, bucketName string) (int64, bool, error) {
+	var deleted int64
+	for page := 0; page < maxEmptyPagesPerReconcile; page++ {
+		uploads, err := svc.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+			Bucket: aws.String(bucketName),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchBucket {
+				return deleted, true, nil
+			}
+			return deleted, false, err
+		}
+		for _, upload := range uploads.Uploads {
+			_, err := svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucketName),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			if err != nil {
+				return deleted, false, err
+			}
+		}
+
+		// Deleted entries no longer show up in the listing, so every page starts from the beginning
+		versions, err := svc.ListObjectVersions(&s3.ListObjectVersionsInput{
+			Bucket:  aws.String(bucketName),
+			MaxKeys: aws.Int64(1000),
+		})
+		if err != nil {
+			return deleted, false, err
+		}
+		objects := []*s3.ObjectIdentifier{}
+		for _, version := range versions.Versions {
+			objects = append(objects, &s3.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range versions.DeleteMarkers {
+			objects = append(objects, &s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		if len(objects) == 0 && len(uploads.Uploads) == 0 {
+			return deleted, true, nil
+		}
+		if len(objects) == 0 {
+			continue
+		}
+
+		output, err := svc.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return deleted, false, err
+		}
+		deleted += int64(len(objects) - len(output.Errors))
+		if len(output.Errors) > 0 {
+			return deleted, false, fmt.Errorf("failed to delete %d objects, first error on '%s': %s",
+				len(output.Errors), aws.StringValue(output.Errors[0].Key), aws.StringValue(output.Errors[0].Message))
+		}
+	}
+
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("Deleted %d objects from S3 bucket '%s'\n", deleted, bucketName)))
+	return deleted, false, nil
+}
+
+// ensureFinalizer adds the s3BucketFinalizer to the S3Bucket if it is missing
+func (r *S3BucketReconciler) ensureFinalizer(ctx context.Context, s3Bucket *bucketv1.S3Bucket) error {
+	if controllerutil.ContainsFinalizer(s3Bucket, s3BucketFinalizer) {
+		return nil
+	}
+	controllerutil.AddFinalizer(s3Bucket, s3BucketFinalizer)
+	return r.Update(ctx, s3Bucket)
+}
+
+// deletionClients returns the clients of the S3ProviderConfig and region of the S3Bucket being deleted,
+// failures are recorded in status
+func (r *S3BucketReconciler) deletionClients(ctx context.Context, s3Bucket *bucketv1.S3Bucket) (*s3config.Clients, error) {
+	clients, err := r.Clients.ForProvider(ctx, s3Bucket.Spec.ProviderConfigRef)
+	if err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to get the AWS clients of the s3Bucket"))
+		setSyncError(s3Bucket, err, ReasonProviderConfigError)
+		if err := r.Status().Update(ctx, s3Bucket); err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+		}
+		return nil, err
+	}
+	return regionalClients(clients, s3Bucket), nil
+}
+
+// backfillBucketCreated records the s3 bucket of S3Buckets from before status.bucketCreated existed as created by
+// the operator. The operator only moves S3Buckets to Pending, Online or Offline after creating their s3 bucket.
+func backfillBucketCreated(s3Bucket *bucketv1.S3Bucket) {
+	switch s3Bucket.Status.Phase {
+	case bucketv1.PhasePending, bucketv1.PhaseOnline, bucketv1.PhaseOffline:
+		s3Bucket.Status.BucketCreated = true
+	}
+}
+
+// reconcileDelete applies the deletion policy to the backing S3 bucket and then releases the S3Bucket object
+// by removing its finalizer. Failed deletions are retried with exponential backoff and recorded in status.Message.
+func (r *S3BucketReconciler) reconcileDelete(ctx context.Context, s3Bucket *bucketv1.S3Bucket) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(s3Bucket, s3BucketFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("Deleting s3Bucket %s", s3Bucket.Name)))
+	original := s3Bucket.Status.DeepCopy()
+	backfillBucketCreated(s3Bucket)
+	s3Bucket.Status.Phase = bucketv1.PhaseDeleting
+	setCondition(s3Bucket, bucketv1.ConditionDeleting, metav1.ConditionTrue, ReasonDeleting,
+		fmt.Sprintf("s3 bucket is being deleted with deletion policy %s", s3Bucket.Spec.DeletionPolicy))
+	setCondition(s3Bucket, bucketv1.ConditionReady, metav1.ConditionFalse, ReasonDeleting, "s3 bucket is being deleted")
+	if err := r.updateStatus(ctx, s3Bucket, original); err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+		return ctrl.Result{}, err
+	}
+
+	// The deny-all policy of an offline s3 bucket is restored first, retained and orphaned s3 buckets must not stay
+	// locked and the previous policy only lives in the S3Bucket
+	if isBucketTakenOffline(s3Bucket) && s3Bucket.Status.BucketCreated {
+		clients, err := r.deletionClients(ctx, s3Bucket)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.bringBucketOnline(ctx, clients.S3, s3Bucket); err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to restore the bucket policy of the offline s3 bucket"))
+			setSyncError(s3Bucket, fmt.Errorf("failed to restore the bucket policy of the offline s3 bucket: %w", err), ReasonDeleteError)
+			if err := r.Status().Update(ctx, s3Bucket); err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	switch s3Bucket.Spec.DeletionPolicy {
+	case bucketv1.DeletionPolicyRetain:
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("Retaining S3 bucket '%s'", s3Bucket.Name)))
+		r.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, "BucketRetained",
+			"S3 bucket %s was retained after deletion of the S3Bucket", s3Bucket.Name)
+	case bucketv1.DeletionPolicyOrphan:
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("Orphaning S3 bucket '%s'", s3Bucket.Name)))
+	default:
+		// S3 buckets the operator didn't create, e.g. after a failed creation, are never deleted
+		if !s3Bucket.Status.BucketCreated {
+			log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' was not created by the operator, skipping deletion", s3Bucket.Name)))
+			r.Recorder.Eventf(s3Bucket, corev1.EventTypeNormal, "BucketNotDeleted",
+				"S3 bucket %s was not created by the operator and was left in place", s3Bucket.Name)
+			break
+		}
+		clients, err := r.deletionClients(ctx, s3Bucket)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if s3Bucket.Spec.ForceDestroy {
+			deleted, isEmpty, err := emptyS3Bucket(clients.S3, s3Bucket.Name)
+			s3Bucket.Status.ObjectsDeleted += deleted
+			if err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to empty s3 bucket"))
+				setSyncError(s3Bucket, fmt.Errorf("failed to empty s3 bucket: %w", err), ReasonDeleteError)
+				if err := r.Status().Update(ctx, s3Bucket); err != nil {
+					log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+				}
+				return ctrl.Result{}, err
+			}
+			// Give other S3Buckets a chance to reconcile before continuing with the next batch
+			if !isEmpty {
+				s3Bucket.Status.Message = fmt.Sprintf("emptying s3 bucket: %d objects deleted", s3Bucket.Status.ObjectsDeleted)
+				setCondition(s3Bucket, bucketv1.ConditionDeleting, metav1.ConditionTrue, ReasonDeleting, s3Bucket.Status.Message)
+				if err := r.Status().Update(ctx, s3Bucket); err != nil {
+					log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+					return ctrl.Result{}, err
+				}
+				return ctrl.Result{RequeueAfter: emptyRequeueInterval}, nil
+			}
+		}
+		if err := deleteS3Bucket(clients.S3, s3Bucket.Name); err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to delete s3 bucket"))
+			setSyncError(s3Bucket, fmt.Errorf("failed to delete s3 bucket: %w", err), ReasonDeleteError)
+			if err := r.Status().Update(ctx, s3Bucket); err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+			}
+			// Returning the error requeues the S3Bucket with exponential backoff
+			return ctrl.Result{}, err
+		}
+		if isReplicationRoleManaged(s3Bucket) {
+			if err := deleteReplicationRole(clients.IAM, s3Bucket.Name); err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to delete replication role"))
+				setSyncError(s3Bucket, fmt.Errorf("failed to delete replication role: %w", err), ReasonDeleteError)
+				if err := r.Status().Update(ctx, s3Bucket); err != nil {
+					log.Log.Error(err, colorCodeMessage("failed to update bucket status"))
+				}
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	controllerutil.RemoveFinalizer(s3Bucket, s3BucketFinalizer)
+	if err := r.Update(ctx, s3Bucket); err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to remove finalizer from s3Bucket"))
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+var _ = Describe("S3Bucket deletion", func() {
+	var (
+		ctx context.Context
+		s3  *fakeS3
+		r   *S3BucketReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		s3 = newFakeS3()
+		r = &S3BucketReconciler{
+			Client:    k8sClient,
+			Scheme:    scheme.Scheme,
+			Recorder:  record.NewFakeRecorder(100),
+			APIReader: k8sClient,
+			Clients:   s3config.NewClientCache(k8sClient, k8sClient, s3.clients()),
+		}
+	})
+
+	AfterEach(func() {
+		s3.close()
+	})
+
+	// createS3Bucket creates an S3Bucket guarded by the finalizer with the given status
+	createS3Bucket := func(name string, spec bucketv1.S3BucketSpec, status bucketv1.S3BucketStatus) *bucketv1.S3Bucket {
+		s3Bucket := &bucketv1.S3Bucket{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Finalizers: []string{s3BucketFinalizer}},
+			Spec:       spec,
+		}
+		Expect(k8sClient.Create(ctx, s3Bucket)).To(Succeed())
+		s3Bucket.Status = status
+		Expect(k8sClient.Status().Update(ctx, s3Bucket)).To(Succeed())
+		return s3Bucket
+	}
+
+	// deleteS3Bucket deletes the S3Bucket and runs one reconcile
+	deleteS3Bucket := func(s3Bucket *bucketv1.S3Bucket) ctrl.Result {
+		Expect(k8sClient.Delete(ctx, s3Bucket)).To(Succeed())
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: s3Bucket.Name, Namespace: s3Bucket.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+
+	// expectReleased checks that the finalizer was removed and the S3Bucket is gone
+	expectReleased := func(s3Bucket *bucketv1.S3Bucket) {
+		err := k8sClient.Get(ctx, types.NamespacedName{Name: s3Bucket.Name, Namespace: s3Bucket.Namespace}, &bucketv1.S3Bucket{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "S3Bucket %s still exists: %v", s3Bucket.Name, err)
+	}
+
+	It("adds the finalizer on creation and deletes the s3 bucket before removing it", func() {
+		s3Bucket := &bucketv1.S3Bucket{
+			ObjectMeta: metav1.ObjectMeta{Name: "deletion-created", Namespace: "default"},
+			Spec:       bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline},
+		}
+		Expect(k8sClient.Create(ctx, s3Bucket)).To(Succeed())
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: s3Bucket.Name, Namespace: s3Bucket.Namespace}}
+
+		By("creating the s3 bucket")
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, s3Bucket)).To(Succeed())
+		Expect(controllerutil.ContainsFinalizer(s3Bucket, s3BucketFinalizer)).To(BeTrue())
+		Expect(s3Bucket.Status.BucketCreated).To(BeTrue())
+		Expect(s3.hasBucket(s3Bucket.Name)).To(BeTrue())
+
+		By("deleting the S3Bucket")
+		deleteS3Bucket(s3Bucket)
+		Expect(s3.hasBucket(s3Bucket.Name)).To(BeFalse())
+		expectReleased(s3Bucket)
+	})
+
+	DescribeTable("keeping the s3 bucket",
+		func(name string, policy bucketv1.DeletionPolicy, status bucketv1.S3BucketStatus) {
+			s3.addBucket(name, 1)
+			s3Bucket := createS3Bucket(name, bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline, DeletionPolicy: policy}, status)
+			deleteS3Bucket(s3Bucket)
+			Expect(s3.hasBucket(name)).To(BeTrue())
+			Expect(s3.objectCount(name)).To(Equal(1))
+			expectReleased(s3Bucket)
+		},
+		Entry("retain", "deletion-retain", bucketv1.DeletionPolicyRetain,
+			bucketv1.S3BucketStatus{Phase: bucketv1.PhaseOnline, BucketCreated: true}),
+		Entry("orphan", "deletion-orphan", bucketv1.DeletionPolicyOrphan,
+			bucketv1.S3BucketStatus{Phase: bucketv1.PhaseOnline, BucketCreated: true}),
+		Entry("not created by the operator", "deletion-not-created", bucketv1.DeletionPolicyDelete,
+			bucketv1.S3BucketStatus{}),
+	)
+
+	It("deletes the s3 bucket of S3Buckets from before status.bucketCreated existed", func() {
+		s3.addBucket("deletion-backfill", 0)
+		s3Bucket := createS3Bucket("deletion-backfill", bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline},
+			bucketv1.S3BucketStatus{Phase: bucketv1.PhaseOnline})
+		deleteS3Bucket(s3Bucket)
+		Expect(s3.hasBucket(s3Bucket.Name)).To(BeFalse())
+		expectReleased(s3Bucket)
+	})
+
+	It("empties the s3 bucket over several reconciles with forceDestroy", func() {
+		s3.addBucket("deletion-force-destroy", 6000)
+		s3Bucket := createS3Bucket("deletion-force-destroy", bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline, ForceDestroy: true},
+			bucketv1.S3BucketStatus{Phase: bucketv1.PhaseOnline, BucketCreated: true})
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: s3Bucket.Name, Namespace: s3Bucket.Namespace}}
+
+		By("deleting a first batch of objects")
+		result := deleteS3Bucket(s3Bucket)
+		Expect(result.RequeueAfter).To(Equal(emptyRequeueInterval))
+		Expect(s3.objectCount(s3Bucket.Name)).To(Equal(1000))
+		Expect(k8sClient.Get(ctx, req.NamespacedName, s3Bucket)).To(Succeed())
+		Expect(s3Bucket.Status.Phase).To(Equal(bucketv1.PhaseDeleting))
+		Expect(s3Bucket.Status.ObjectsDeleted).To(Equal(int64(5000)))
+
+		By("deleting the remaining objects and the s3 bucket")
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s3.hasBucket(s3Bucket.Name)).To(BeFalse())
+		expectReleased(s3Bucket)
+	})
+
+	It("restores the bucket policy of an offline s3 bucket before retaining it", func() {
+		previous := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::deletion-offline/*"}]}`
+		s3.addBucket("deletion-offline", 0)
+		s3.setPolicy("deletion-offline", offlinePolicy("deletion-offline", "AROAEXAMPLE:operator"))
+		s3Bucket := &bucketv1.S3Bucket{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "deletion-offline",
+				Namespace:   "default",
+				Finalizers:  []string{s3BucketFinalizer},
+				Annotations: map[string]string{bucketv1.PreOfflinePolicyAnnotation: previous},
+			},
+			Spec: bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOffline, DeletionPolicy: bucketv1.DeletionPolicyRetain},
+		}
+		Expect(k8sClient.Create(ctx, s3Bucket)).To(Succeed())
+		s3Bucket.Status = bucketv1.S3BucketStatus{Phase: bucketv1.PhaseOffline, BucketCreated: true}
+		Expect(k8sClient.Status().Update(ctx, s3Bucket)).To(Succeed())
+
+		deleteS3Bucket(s3Bucket)
+		Expect(s3.bucketPolicy(s3Bucket.Name)).To(Equal(previous))
+		expectReleased(s3Bucket)
+	})
+})
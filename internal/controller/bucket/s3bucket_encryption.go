@@ -0,0 +1,138 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoEncryption is returned by GetBucketEncryption for buckets without default encryption
+const errCodeNoEncryption = "ServerSideEncryptionConfigurationNotFoundError"
+
+// desiredEncryption resolves the encryption block of the S3Bucket, defaulting to SSE-S3
+func (r *S3BucketReconciler) desiredEncryption(ctx context.Context, s3Bucket *bucketv1.S3Bucket) (bucketv1.EncryptionStatus, error) {
+	desired := bucketv1.EncryptionStatus{Algorithm: string(bucketv1.EncryptionAES256)}
+	encryption := s3Bucket.Spec.Encryption
+	if encryption == nil {
+		return desired, nil
+	}
+	if encryption.Algorithm != "" {
+		desired.Algorithm = string(encryption.Algorithm)
+	}
+	desired.BucketKeyEnabled = encryption.BucketKeyEnabled
+	if desired.Algorithm != string(bucketv1.EncryptionKMS) {
+		return desired, nil
+	}
+
+	desired.KMSKeyID = encryption.KMSKeyID
+	if desired.KMSKeyID == "" && encryption.KMSKeyRef != nil {
+		keyID, err := r.resolveValueReference(ctx, s3Bucket.Namespace, encryption.KMSKeyRef)
+		if err != nil {
+			return desired, fmt.Errorf("failed to resolve kmsKeyRef: %w", err)
+		}
+		desired.KMSKeyID = strings.TrimSpace(keyID)
+	}
+	return desired, nil
+}
+
+// getBucketEncryption retrieves the default encryption of the S3 bucket, an empty status if it has none
+func getBucketEncryption(svc *s3.S3, bucketName string) (bucketv1.EncryptionStatus, error) {
+	observed := bucketv1.EncryptionStatus{}
+	result, err := svc.GetBucketEncryption(&s3.GetBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoEncryption {
+			return observed, nil
+		}
+		return observed, err
+	}
+	if result.ServerSideEncryptionConfiguration == nil || len(result.ServerSideEncryptionConfiguration.Rules) == 0 {
+		return observed, nil
+	}
+	rule := result.ServerSideEncryptionConfiguration.Rules[0]
+	if rule.ApplyServerSideEncryptionByDefault != nil {
+		observed.Algorithm = aws.StringValue(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+		observed.KMSKeyID = aws.StringValue(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID)
+	}
+	observed.BucketKeyEnabled = aws.BoolValue(rule.BucketKeyEnabled)
+	return observed, nil
+}
+
+// kmsKeyMatches compares KMS key IDs, S3 may report the ARN of a key that was given by ID
+func kmsKeyMatches(desired string, observed string) bool {
+	return desired == observed || strings.HasSuffix(observed, "/"+desired)
+}
+
+// encryptionMatches checks whether the observed encryption of the S3 bucket satisfies the desired one
+func encryptionMatches(desired bucketv1.EncryptionStatus, observed bucketv1.EncryptionStatus) bool {
+	if desired.Algorithm != observed.Algorithm || desired.BucketKeyEnabled != observed.BucketKeyEnabled {
+		return false
+	}
+	return kmsKeyMatches(desired.KMSKeyID, observed.KMSKeyID)
+}
+
+// reconcileEncryption applies the desired default server-side encryption to the S3 bucket
+func reconcileEncryption(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	desired, err := r.desiredEncryption(ctx, s3Bucket)
+	if err != nil {
+		return err
+	}
+	observed, err := getBucketEncryption(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket encryption: %w", err)
+	}
+	if encryptionMatches(desired, observed) {
+		s3Bucket.Status.Encryption = &observed
+		return nil
+	}
+
+	byDefault := &s3.ServerSideEncryptionByDefault{
+		SSEAlgorithm: aws.String(desired.Algorithm),
+	}
+	if desired.KMSKeyID != "" {
+		byDefault.KMSMasterKeyID = aws.String(desired.KMSKeyID)
+	}
+	_, err = svc.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+		Bucket: aws.String(s3Bucket.Name),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: byDefault,
+				BucketKeyEnabled:                   aws.Bool(desired.BucketKeyEnabled),
+			}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket encryption: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' encryption set to %s\n", s3Bucket.Name, desired.Algorithm)))
+	s3Bucket.Status.Encryption = &desired
+	return nil
+}
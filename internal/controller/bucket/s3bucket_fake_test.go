@@ -0,0 +1,264 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// fakeS3 is an in-memory S3 endpoint serving the path-style bucket and object calls of the reconciler.
+// The IAM and STS calls sharing the endpoint are recorded and answered for the AWS account of the fakeS3.
+type fakeS3 struct {
+	mu       sync.Mutex
+	account  string
+	buckets  map[string]*fakeBucket
+	iamCalls []string
+	server   *httptest.Server
+}
+
+// fakeBucket is an S3 bucket of fakeS3
+type fakeBucket struct {
+	objects     map[string]bool
+	policy      string
+	replication bool
+	logging     string
+}
+
+// newFakeS3 starts a fakeS3 holding no buckets
+func newFakeS3() *fakeS3 {
+	f := &fakeS3{account: "123456789012", buckets: map[string]*fakeBucket{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// clients returns the AWS clients talking to the fakeS3
+func (f *fakeS3) clients() *s3config.Clients {
+	config := s3config.Config{Endpoint: f.server.URL, Region: "us-east-1", ForcePathStyle: aws.Bool(true)}
+	session, err := config.NewSession(credentials.NewStaticCredentials("test", "test", ""))
+	if err != nil {
+		panic(err)
+	}
+	return s3config.NewClients(session)
+}
+
+// close stops the fakeS3
+func (f *fakeS3) close() {
+	f.server.Close()
+}
+
+// addBucket creates a bucket holding the given number of objects
+func (f *fakeS3) addBucket(name string, objects int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket := &fakeBucket{objects: map[string]bool{}}
+	for i := 0; i < objects; i++ {
+		bucket.objects[fmt.Sprintf("object-%05d", i)] = true
+	}
+	f.buckets[name] = bucket
+}
+
+// hasBucket checks whether the bucket exists
+func (f *fakeS3) hasBucket(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.buckets[name]
+	return ok
+}
+
+// objectCount returns the number of objects in the bucket
+func (f *fakeS3) objectCount(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.buckets[name].objects)
+}
+
+// setPolicy sets the bucket policy of the bucket
+func (f *fakeS3) setPolicy(name string, policy string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[name].policy = policy
+}
+
+// bucketPolicy returns the bucket policy of the bucket
+func (f *fakeS3) bucketPolicy(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buckets[name].policy
+}
+
+// setReplication configures replication on the bucket
+func (f *fakeS3) setReplication(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[name].replication = true
+}
+
+// hasReplication checks whether replication is configured on the bucket
+func (f *fakeS3) hasReplication(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buckets[name].replication
+}
+
+// setLogging enables server access logging of the bucket to the target bucket
+func (f *fakeS3) setLogging(name string, targetBucket string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[name].logging = targetBucket
+}
+
+// loggingTarget returns the target bucket of the server access logging of the bucket, empty when disabled
+func (f *fakeS3) loggingTarget(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buckets[name].logging
+}
+
+// recordedIAMCalls returns the actions of the IAM calls received so far
+func (f *fakeS3) recordedIAMCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.iamCalls...)
+}
+
+// serveQuery answers the IAM and STS calls, which use the query protocol
+func (f *fakeS3) serveQuery(w http.ResponseWriter, req *http.Request) {
+	action := req.PostFormValue("Action")
+	if action == "GetCallerIdentity" {
+		fmt.Fprintf(w, "<GetCallerIdentityResponse><GetCallerIdentityResult><Account>%s</Account>"+
+			"<UserId>AROAEXAMPLE:operator</UserId><Arn>arn:aws:sts::%s:assumed-role/operator/operator</Arn>"+
+			"</GetCallerIdentityResult></GetCallerIdentityResponse>", f.account, f.account)
+		return
+	}
+	f.iamCalls = append(f.iamCalls, action)
+	fmt.Fprintf(w, "<%sResponse></%sResponse>", action, action)
+}
+
+// writeError writes an S3 error response
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)[0]
+	if name == "" && req.Method == http.MethodPost {
+		f.serveQuery(w, req)
+		return
+	}
+	query := req.URL.Query()
+	bucket, ok := f.buckets[name]
+	if req.Method == http.MethodPut && len(query) == 0 {
+		if ok {
+			writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou")
+			return
+		}
+		f.buckets[name] = &fakeBucket{objects: map[string]bool{}}
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case req.Method == http.MethodHead:
+	case req.Method == http.MethodDelete && query.Has("replication"):
+		bucket.replication = false
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodPut && query.Has("logging"):
+		var input struct {
+			TargetBucket string `xml:"LoggingEnabled>TargetBucket"`
+		}
+		if err := xml.NewDecoder(req.Body).Decode(&input); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		bucket.logging = input.TargetBucket
+	case req.Method == http.MethodDelete && query.Has("policy"):
+		bucket.policy = ""
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodPut && query.Has("policy"):
+		policy, _ := io.ReadAll(req.Body)
+		bucket.policy = string(policy)
+	case req.Method == http.MethodGet && query.Has("policy"):
+		if bucket.policy == "" {
+			writeError(w, http.StatusNotFound, errCodeNoSuchBucketPolicy)
+			return
+		}
+		w.Write([]byte(bucket.policy))
+	case req.Method == http.MethodDelete:
+		if len(bucket.objects) > 0 {
+			writeError(w, http.StatusConflict, "BucketNotEmpty")
+			return
+		}
+		delete(f.buckets, name)
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodGet && query.Has("uploads"):
+		fmt.Fprint(w, "<ListMultipartUploadsResult></ListMultipartUploadsResult>")
+	case req.Method == http.MethodGet && query.Has("versions"):
+		maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+		if err != nil {
+			maxKeys = 1000
+		}
+		keys := make([]string, 0, len(bucket.objects))
+		for key := range bucket.objects {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if len(keys) > maxKeys {
+			keys = keys[:maxKeys]
+		}
+		fmt.Fprint(w, "<ListVersionsResult>")
+		for _, key := range keys {
+			fmt.Fprintf(w, "<Version><Key>%s</Key><VersionId>null</VersionId></Version>", key)
+		}
+		fmt.Fprint(w, "</ListVersionsResult>")
+	case req.Method == http.MethodPost && query.Has("delete"):
+		var input struct {
+			Objects []struct {
+				Key string `xml:"Key"`
+			} `xml:"Object"`
+		}
+		if err := xml.NewDecoder(req.Body).Decode(&input); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		for _, object := range input.Objects {
+			delete(bucket.objects, object.Key)
+		}
+		fmt.Fprint(w, "<DeleteResult></DeleteResult>")
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoSuchLifecycleConfiguration is returned by GetBucketLifecycleConfiguration for buckets without lifecycle rules
+const errCodeNoSuchLifecycleConfiguration = "NoSuchLifecycleConfiguration"
+
+// lifecycleFilter builds the S3 filter matching the prefix and tags of the lifecycle rule
+func lifecycleFilter(rule bucketv1.LifecycleRule) *s3.LifecycleRuleFilter {
+	tags := toS3Tags(rule.Tags)
+	switch {
+	case len(tags) == 0:
+		return &s3.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)}
+	case len(tags) == 1 && rule.Prefix == "":
+		return &s3.LifecycleRuleFilter{Tag: tags[0]}
+	default:
+		and := &s3.LifecycleRuleAndOperator{Tags: tags}
+		if rule.Prefix != "" {
+			and.Prefix = aws.String(rule.Prefix)
+		}
+		return &s3.LifecycleRuleFilter{And: and}
+	}
+}
+
+// toS3LifecycleRule converts the lifecycle rule of the S3Bucket spec to an S3 lifecycle rule
+func toS3LifecycleRule(rule bucketv1.LifecycleRule) *s3.LifecycleRule {
+	s3Rule := &s3.LifecycleRule{
+		ID:     aws.String(rule.ID),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: lifecycleFilter(rule),
+	}
+	if rule.Disabled {
+		s3Rule.Status = aws.String(s3.ExpirationStatusDisabled)
+	}
+	if rule.ExpirationDays > 0 {
+		s3Rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(rule.ExpirationDays)}
+	}
+	if rule.NoncurrentVersionExpirationDays > 0 {
+		s3Rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{
+			NoncurrentDays: aws.Int64(rule.NoncurrentVersionExpirationDays),
+		}
+	}
+	for _, transition := range rule.Transitions {
+		s3Rule.Transitions = append(s3Rule.Transitions, &s3.Transition{
+			Days:         aws.Int64(transition.Days),
+			StorageClass: aws.String(transition.StorageClass),
+		})
+	}
+	if rule.AbortIncompleteMultipartUploadDays > 0 {
+		s3Rule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int64(rule.AbortIncompleteMultipartUploadDays),
+		}
+	}
+	return s3Rule
+}
+
+// fromS3LifecycleRule converts an S3 lifecycle rule to the form of the S3Bucket spec, so both can be compared
+func fromS3LifecycleRule(s3Rule *s3.LifecycleRule) bucketv1.LifecycleRule {
+	rule := bucketv1.LifecycleRule{
+		ID:       aws.StringValue(s3Rule.ID),
+		Disabled: aws.StringValue(s3Rule.Status) == s3.ExpirationStatusDisabled,
+		Prefix:   aws.StringValue(s3Rule.Prefix),
+	}
+	if filter := s3Rule.Filter; filter != nil {
+		switch {
+		case filter.And != nil:
+			rule.Prefix = aws.StringValue(filter.And.Prefix)
+			rule.Tags = fromS3Tags(filter.And.Tags)
+		case filter.Tag != nil:
+			rule.Tags = fromS3Tags([]*s3.Tag{filter.Tag})
+		default:
+			rule.Prefix = aws.StringValue(filter.Prefix)
+		}
+	}
+	if s3Rule.Expiration != nil {
+		rule.ExpirationDays = aws.Int64Value(s3Rule.Expiration.Days)
+	}
+	if s3Rule.NoncurrentVersionExpiration != nil {
+		rule.NoncurrentVersionExpirationDays = aws.Int64Value(s3Rule.NoncurrentVersionExpiration.NoncurrentDays)
+	}
+	for _, transition := range s3Rule.Transitions {
+		rule.Transitions = append(rule.Transitions, bucketv1.LifecycleTransition{
+			Days:         aws.Int64Value(transition.Days),
+			StorageClass: aws.StringValue(transition.StorageClass),
+		})
+	}
+	if s3Rule.AbortIncompleteMultipartUpload != nil {
+		rule.AbortIncompleteMultipartUploadDays = aws.Int64Value(s3Rule.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+	}
+	return rule
+}
+
+// toS3Tags converts a tag map to S3 tags, sorted by key
+func toS3Tags(tags map[string]string) []*s3.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s3Tags := make([]*s3.Tag, 0, len(tags))
+	for _, key := range keys {
+		s3Tags = append(s3Tags, &s3.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return s3Tags
+}
+
+// fromS3Tags converts S3 tags to a tag map
+func fromS3Tags(s3Tags []*s3.Tag) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range s3Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags
+}
+
+// sortLifecycleRules sorts lifecycle rules by ID, S3 doesn't preserve their order
+func sortLifecycleRules(rules []bucketv1.LifecycleRule) {
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+// getBucketLifecycleRules retrieves the lifecycle rules of the S3 bucket, sorted by ID
+func getBucketLifecycleRules(svc *s3.S3, bucketName string) ([]bucketv1.LifecycleRule, error) {
+	result, err := svc.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoSuchLifecycleConfiguration {
+			return nil, nil
+		}
+		return nil, err
+	}
+	rules := []bucketv1.LifecycleRule{}
+	for _, s3Rule := range result.Rules {
+		rules = append(rules, fromS3LifecycleRule(s3Rule))
+	}
+	sortLifecycleRules(rules)
+	return rules, nil
+}
+
+// reconcileLifecycle applies the desired lifecycle rules to the S3 bucket, writing them only when they changed
+func reconcileLifecycle(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	if len(s3Bucket.Spec.LifecycleRules) == 0 {
+		if !s3Bucket.Status.LifecycleManaged {
+			return nil
+		}
+		// The rules were removed from the spec, remove the configuration the operator applied
+		_, err := svc.DeleteBucketLifecycle(&s3.DeleteBucketLifecycleInput{Bucket: aws.String(s3Bucket.Name)})
+		if err != nil {
+			return fmt.Errorf("failed to delete bucket lifecycle configuration: %w", err)
+		}
+		s3Bucket.Status.LifecycleManaged = false
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' lifecycle configuration deleted\n", s3Bucket.Name)))
+		return nil
+	}
+	s3Bucket.Status.LifecycleManaged = true
+	desired := make([]bucketv1.LifecycleRule, len(s3Bucket.Spec.LifecycleRules))
+	copy(desired, s3Bucket.Spec.LifecycleRules)
+	sortLifecycleRules(desired)
+
+	observed, err := getBucketLifecycleRules(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket lifecycle configuration: %w", err)
+	}
+	// Semantic equality treats nil and empty tags or transitions as equal
+	if equality.Semantic.DeepEqual(desired, observed) {
+		return nil
+	}
+
+	s3Rules := []*s3.LifecycleRule{}
+	for _, rule := range desired {
+		s3Rules = append(s3Rules, toS3LifecycleRule(rule))
+	}
+	_, err = svc.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s3Bucket.Name),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: s3Rules},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket lifecycle configuration: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' lifecycle configuration updated with %d rules\n", s3Bucket.Name, len(s3Rules))))
+	return nil
+}
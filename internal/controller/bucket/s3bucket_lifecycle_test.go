@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+var _ = Describe("S3Bucket lifecycle rules", func() {
+	DescribeTable("comparing spec rules with the rules S3 returns",
+		func(rule bucketv1.LifecycleRule) {
+			Expect(equality.Semantic.DeepEqual(fromS3LifecycleRule(toS3LifecycleRule(rule)), rule)).To(BeTrue())
+		},
+		Entry("expiration", bucketv1.LifecycleRule{ID: "expire", ExpirationDays: 30}),
+		Entry("prefix", bucketv1.LifecycleRule{ID: "logs", Prefix: "logs/", NoncurrentVersionExpirationDays: 7}),
+		Entry("single tag", bucketv1.LifecycleRule{ID: "tmp", Tags: map[string]string{"tmp": "true"}, ExpirationDays: 1}),
+		Entry("prefix and tags", bucketv1.LifecycleRule{
+			ID:       "archive",
+			Prefix:   "data/",
+			Tags:     map[string]string{"a": "1", "b": "2"},
+			Disabled: true,
+		}),
+		Entry("transitions", bucketv1.LifecycleRule{
+			ID: "tiering",
+			Transitions: []bucketv1.LifecycleTransition{
+				{Days: 30, StorageClass: s3.TransitionStorageClassStandardIa},
+				{Days: 90, StorageClass: s3.TransitionStorageClassGlacier},
+			},
+			AbortIncompleteMultipartUploadDays: 3,
+		}),
+	)
+
+	DescribeTable("reading rules written by other clients",
+		func(s3Rule *s3.LifecycleRule, want bucketv1.LifecycleRule) {
+			Expect(equality.Semantic.DeepEqual(fromS3LifecycleRule(s3Rule), want)).To(BeTrue())
+		},
+		Entry("legacy prefix", &s3.LifecycleRule{
+			ID:         aws.String("legacy"),
+			Status:     aws.String(s3.ExpirationStatusEnabled),
+			Prefix:     aws.String("old/"),
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(10)},
+		}, bucketv1.LifecycleRule{ID: "legacy", Prefix: "old/", ExpirationDays: 10}),
+		Entry("empty filter", &s3.LifecycleRule{
+			ID:         aws.String("all"),
+			Status:     aws.String(s3.ExpirationStatusDisabled),
+			Filter:     &s3.LifecycleRuleFilter{},
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(10)},
+		}, bucketv1.LifecycleRule{ID: "all", Disabled: true, ExpirationDays: 10}),
+	)
+
+	It("sorts rules by ID, S3 doesn't keep their order", func() {
+		rules := []bucketv1.LifecycleRule{{ID: "c"}, {ID: "a"}, {ID: "b"}}
+		sortLifecycleRules(rules)
+		Expect(rules).To(Equal([]bucketv1.LifecycleRule{{ID: "a"}, {ID: "b"}, {ID: "c"}}))
+	})
+})
@@ -0,0 +1,286 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// logDeliveryPrincipal is the service principal writing server access logs to target buckets
+const logDeliveryPrincipal = "logging.s3.amazonaws.com"
+
+// logDeliverySidPrefix prefixes the Sids of the statements granting log delivery on target buckets.
+// These statements are added by the S3Buckets logging to the bucket, reconcilePolicy keeps them.
+const logDeliverySidPrefix = "S3ServerAccessLogs"
+
+// logDeliverySid returns the Sid of the statement granting log delivery from the source bucket.
+// Sids only allow alphanumerics, the source bucket name is hashed so that distinct names never collide.
+func logDeliverySid(sourceBucket string) string {
+	hash := sha256.Sum256([]byte(sourceBucket))
+	return logDeliverySidPrefix + hex.EncodeToString(hash[:])[:16]
+}
+
+// resolveLoggingTarget returns the name of the target bucket of the access logs and the clients to reach it.
+// Target s3 buckets not managed by the operator are reached with the clients of the S3Bucket.
+// Returns a dependencyError while the target S3Bucket is not online.
+func (r *S3BucketReconciler) resolveLoggingTarget(ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) (string, *s3config.Clients, error) {
+	logging := s3Bucket.Spec.Logging
+	if logging.TargetBucket != "" {
+		return logging.TargetBucket, clients, nil
+	}
+	target, err := r.resolveOnlineBucket(ctx, s3Bucket.Namespace, logging.TargetBucketRef, "logging target")
+	if err != nil {
+		return "", nil, err
+	}
+	targetClients, err := r.bucketClients(ctx, target)
+	if err != nil {
+		return "", nil, err
+	}
+	return target.Name, targetClients, nil
+}
+
+// resolveOnlineBucket returns the referenced S3Bucket.
+// Returns a dependencyError while the S3Bucket doesn't exist or is not online.
+func (r *S3BucketReconciler) resolveOnlineBucket(ctx context.Context, namespace string, name string, role string) (*bucketv1.S3Bucket, error) {
+	target := &bucketv1.S3Bucket{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, target)
+	if errors.IsNotFound(err) {
+		return nil, &dependencyError{
+			reason:  ReasonTargetNotFound,
+			message: fmt.Sprintf("waiting for %s S3Bucket %s to be created", role, name),
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s S3Bucket %s: %w", role, name, err)
+	}
+	if target.Status.Phase != bucketv1.PhaseOnline {
+		return nil, &dependencyError{
+			reason:  ReasonTargetNotOnline,
+			message: fmt.Sprintf("waiting for %s S3Bucket %s to be online", role, name),
+		}
+	}
+	return target, nil
+}
+
+// logDeliveryStatement renders the bucket policy statement allowing S3 to write the access logs of the source bucket
+func logDeliveryStatement(targetBucket string, targetPrefix string, sourceBucket string) map[string]interface{} {
+	return map[string]interface{}{
+		"Sid":       logDeliverySid(sourceBucket),
+		"Effect":    "Allow",
+		"Principal": map[string]interface{}{"Service": logDeliveryPrincipal},
+		"Action":    "s3:PutObject",
+		"Resource":  bucketARN(targetBucket) + "/" + targetPrefix + "*",
+		"Condition": map[string]interface{}{
+			"ArnLike": map[string]interface{}{"aws:SourceArn": bucketARN(sourceBucket)},
+		},
+	}
+}
+
+// grantLogDelivery adds the statement allowing log delivery from the source bucket to the policy of the target bucket,
+// keeping its other statements. ACLs are disabled on new buckets, so log delivery is granted with the bucket policy.
+func grantLogDelivery(svc *s3.S3, targetBucket string, targetPrefix string, sourceBucket string) error {
+	current, err := getBucketPolicy(svc, targetBucket)
+	if err != nil {
+		return err
+	}
+	policy := map[string]interface{}{"Version": "2012-10-17"}
+	if current != "" {
+		if err := json.Unmarshal([]byte(current), &policy); err != nil {
+			return fmt.Errorf("invalid bucket policy: %w", err)
+		}
+	}
+	statements := policyStatements(policy)
+
+	desired := logDeliveryStatement(targetBucket, targetPrefix, sourceBucket)
+	found := false
+	for i, statement := range statements {
+		fields, ok := statement.(map[string]interface{})
+		if !ok || fields["Sid"] != desired["Sid"] {
+			continue
+		}
+		if reflect.DeepEqual(normalizeStatement(statement), normalizeStatement(desired)) {
+			return nil
+		}
+		statements[i] = desired
+		found = true
+	}
+	if !found {
+		statements = append(statements, desired)
+	}
+	policy["Statement"] = statements
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if err := putBucketPolicy(svc, targetBucket, string(data)); err != nil {
+		return err
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' granted log delivery from '%s'\n", targetBucket, sourceBucket)))
+	return nil
+}
+
+// revokeLogDelivery removes the statement allowing log delivery from the source bucket from the policy of the target
+// bucket, keeping its other statements. A target bucket that no longer exists has nothing to revoke.
+func revokeLogDelivery(svc *s3.S3, targetBucket string, sourceBucket string) error {
+	current, err := getBucketPolicy(svc, targetBucket)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchBucket {
+			return nil
+		}
+		return err
+	}
+	if current == "" {
+		return nil
+	}
+	var policy map[string]interface{}
+	if err := json.Unmarshal([]byte(current), &policy); err != nil {
+		return fmt.Errorf("invalid bucket policy: %w", err)
+	}
+
+	sid := logDeliverySid(sourceBucket)
+	statements := []interface{}{}
+	for _, statement := range policyStatements(policy) {
+		if fields, ok := statement.(map[string]interface{}); !ok || fields["Sid"] != sid {
+			statements = append(statements, statement)
+		}
+	}
+	if len(statements) == len(policyStatements(policy)) {
+		return nil
+	}
+
+	// A policy without statements is invalid, the policy is deleted instead
+	desired := ""
+	if len(statements) > 0 {
+		policy["Statement"] = statements
+		data, err := json.Marshal(policy)
+		if err != nil {
+			return err
+		}
+		desired = string(data)
+	}
+	if err := putBucketPolicy(svc, targetBucket, desired); err != nil {
+		return err
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' revoked log delivery from '%s'\n", targetBucket, sourceBucket)))
+	return nil
+}
+
+// loggingTargetClients returns the clients to reach the logging target the operator granted log delivery on.
+// Targets managed by an S3Bucket are reached with its clients, other targets with the clients of the S3Bucket.
+func (r *S3BucketReconciler) loggingTargetClients(ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) (*s3config.Clients, error) {
+	target := &bucketv1.S3Bucket{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: s3Bucket.Namespace, Name: s3Bucket.Status.LoggingTarget}, target)
+	if errors.IsNotFound(err) {
+		return clients, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.bucketClients(ctx, target)
+}
+
+// revokeLoggingTarget revokes log delivery on the logging target recorded in status
+func (r *S3BucketReconciler) revokeLoggingTarget(ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	targetClients, err := r.loggingTargetClients(ctx, clients, s3Bucket)
+	if err != nil {
+		return err
+	}
+	if err := revokeLogDelivery(targetClients.S3, s3Bucket.Status.LoggingTarget, s3Bucket.Name); err != nil {
+		return fmt.Errorf("failed to revoke log delivery permissions on %s: %w", s3Bucket.Status.LoggingTarget, err)
+	}
+	s3Bucket.Status.LoggingTarget = ""
+	return nil
+}
+
+// reconcileLogging enables server access logging of the S3 bucket once its target bucket is ready.
+// Once the logging is removed from the spec, it is disabled and log delivery is revoked on the target bucket.
+func reconcileLogging(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	if s3Bucket.Spec.Logging == nil {
+		if s3Bucket.Status.LoggingTarget == "" {
+			return nil
+		}
+		_, err := svc.PutBucketLogging(&s3.PutBucketLoggingInput{
+			Bucket:              aws.String(s3Bucket.Name),
+			BucketLoggingStatus: &s3.BucketLoggingStatus{},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put bucket logging: %w", err)
+		}
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' logging disabled\n", s3Bucket.Name)))
+		return r.revokeLoggingTarget(ctx, clients, s3Bucket)
+	}
+	targetBucket, targetClients, err := r.resolveLoggingTarget(ctx, clients, s3Bucket)
+	if err != nil {
+		return err
+	}
+
+	targetPrefix := s3Bucket.Spec.Logging.TargetPrefix
+	if err := grantLogDelivery(targetClients.S3, targetBucket, targetPrefix, s3Bucket.Name); err != nil {
+		return fmt.Errorf("failed to grant log delivery permissions on %s: %w", targetBucket, err)
+	}
+	// The previous target keeps its grant until the logging moved to the new one
+	previousTarget := s3Bucket.Status.LoggingTarget
+	s3Bucket.Status.LoggingTarget = targetBucket
+
+	observed, err := svc.GetBucketLogging(&s3.GetBucketLoggingInput{
+		Bucket: aws.String(s3Bucket.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get bucket logging: %w", err)
+	}
+	if enabled := observed.LoggingEnabled; enabled == nil ||
+		aws.StringValue(enabled.TargetBucket) != targetBucket || aws.StringValue(enabled.TargetPrefix) != targetPrefix {
+		_, err = svc.PutBucketLogging(&s3.PutBucketLoggingInput{
+			Bucket: aws.String(s3Bucket.Name),
+			BucketLoggingStatus: &s3.BucketLoggingStatus{
+				LoggingEnabled: &s3.LoggingEnabled{
+					TargetBucket: aws.String(targetBucket),
+					TargetPrefix: aws.String(targetPrefix),
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put bucket logging: %w", err)
+		}
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' logging to '%s'\n", s3Bucket.Name, targetBucket)))
+	}
+	if previousTarget != "" && previousTarget != targetBucket {
+		s3Bucket.Status.LoggingTarget = previousTarget
+		if err := r.revokeLoggingTarget(ctx, clients, s3Bucket); err != nil {
+			return err
+		}
+		s3Bucket.Status.LoggingTarget = targetBucket
+	}
+	return nil
+}
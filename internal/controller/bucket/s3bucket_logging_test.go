@@ -0,0 +1,88 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+var _ = Describe("S3Bucket logging", func() {
+	It("grants log delivery to distinct source buckets with distinct statements", func() {
+		Expect(logDeliverySid("a-b")).NotTo(Equal(logDeliverySid("ab")))
+		Expect(logDeliverySid("a-b")).To(MatchRegexp("^" + logDeliverySidPrefix + "[0-9a-f]+$"))
+	})
+
+	Context("removing the logging from the spec", func() {
+		var s3 *fakeS3
+		var reconciler *S3BucketReconciler
+
+		BeforeEach(func() {
+			s3 = newFakeS3()
+			s3.addBucket("logged", 0)
+			s3.addBucket("access-logs", 0)
+			s3.setLogging("logged", "access-logs")
+			reconciler = &S3BucketReconciler{Client: k8sClient}
+		})
+
+		AfterEach(func() {
+			s3.close()
+		})
+
+		removed := func() *bucketv1.S3Bucket {
+			return &bucketv1.S3Bucket{
+				ObjectMeta: metav1.ObjectMeta{Name: "logged", Namespace: "default"},
+				Status:     bucketv1.S3BucketStatus{LoggingTarget: "access-logs"},
+			}
+		}
+
+		It("disables the logging and deletes a policy only granting log delivery", func() {
+			Expect(grantLogDelivery(s3.clients().S3, "access-logs", "logged/", "logged")).To(Succeed())
+
+			s3Bucket := removed()
+			Expect(reconcileLogging(reconciler, context.Background(), s3.clients(), s3Bucket)).To(Succeed())
+			Expect(s3.loggingTarget("logged")).To(BeEmpty())
+			Expect(s3.bucketPolicy("access-logs")).To(BeEmpty())
+			Expect(s3Bucket.Status.LoggingTarget).To(BeEmpty())
+		})
+
+		It("keeps the statements granting log delivery to other source buckets", func() {
+			Expect(grantLogDelivery(s3.clients().S3, "access-logs", "other/", "other")).To(Succeed())
+			kept := s3.bucketPolicy("access-logs")
+			Expect(grantLogDelivery(s3.clients().S3, "access-logs", "logged/", "logged")).To(Succeed())
+
+			s3Bucket := removed()
+			Expect(reconcileLogging(reconciler, context.Background(), s3.clients(), s3Bucket)).To(Succeed())
+			Expect(s3.loggingTarget("logged")).To(BeEmpty())
+			Expect(policiesEqual(s3.bucketPolicy("access-logs"), kept)).To(BeTrue(),
+				"got %s, want %s", s3.bucketPolicy("access-logs"), kept)
+		})
+
+		It("leaves logging the operator didn't enable alone", func() {
+			s3Bucket := removed()
+			s3Bucket.Status.LoggingTarget = ""
+			Expect(reconcileLogging(reconciler, context.Background(), s3.clients(), s3Bucket)).To(Succeed())
+			Expect(s3.loggingTarget("logged")).To(Equal("access-logs"))
+		})
+	})
+})
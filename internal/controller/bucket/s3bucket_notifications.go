@@ -0,0 +1,226 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// Target types of bucket notifications
+const (
+	notificationQueue  = "Queue"
+	notificationTopic  = "Topic"
+	notificationLambda = "Lambda"
+)
+
+// notification is the comparable form of a bucket notification, resolved to the ARN of its target
+type notification struct {
+	ID     string
+	Type   string
+	ARN    string
+	Events []string
+	Prefix string
+	Suffix string
+}
+
+// resolveQueueARN looks up the ARN of the SQS queue
+func resolveQueueARN(svc *sqs.SQS, queueName string) (string, error) {
+	queueURL, err := svc.GetQueueUrl(&sqs.GetQueueUrlInput{
+		QueueName: aws.String(queueName),
+	})
+	if err != nil {
+		return "", err
+	}
+	attributes, err := svc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       queueURL.QueueUrl,
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(attributes.Attributes[sqs.QueueAttributeNameQueueArn]), nil
+}
+
+// desiredNotifications resolves the notifications of the S3Bucket spec, sorted by ID
+func desiredNotifications(sqsSvc *sqs.SQS, s3Bucket *bucketv1.S3Bucket) ([]notification, error) {
+	notifications := []notification{}
+	for _, spec := range s3Bucket.Spec.Notifications {
+		n := notification{
+			ID:     spec.ID,
+			Events: append([]string{}, spec.Events...),
+			Prefix: spec.Prefix,
+			Suffix: spec.Suffix,
+		}
+		switch {
+		case spec.QueueARN != "":
+			n.Type, n.ARN = notificationQueue, spec.QueueARN
+		case spec.QueueName != "":
+			queueARN, err := resolveQueueARN(sqsSvc, spec.QueueName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve queue %s: %w", spec.QueueName, err)
+			}
+			n.Type, n.ARN = notificationQueue, queueARN
+		case spec.TopicARN != "":
+			n.Type, n.ARN = notificationTopic, spec.TopicARN
+		case spec.LambdaFunctionARN != "":
+			n.Type, n.ARN = notificationLambda, spec.LambdaFunctionARN
+		}
+		sort.Strings(n.Events)
+		notifications = append(notifications, n)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+	return notifications, nil
+}
+
+// toS3NotificationFilter builds the key filter of a notification, nil when it has no filters
+func toS3NotificationFilter(n notification) *s3.NotificationConfigurationFilter {
+	rules := []*s3.FilterRule{}
+	if n.Prefix != "" {
+		rules = append(rules, &s3.FilterRule{Name: aws.String(s3.FilterRuleNamePrefix), Value: aws.String(n.Prefix)})
+	}
+	if n.Suffix != "" {
+		rules = append(rules, &s3.FilterRule{Name: aws.String(s3.FilterRuleNameSuffix), Value: aws.String(n.Suffix)})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &s3.NotificationConfigurationFilter{Key: &s3.KeyFilter{FilterRules: rules}}
+}
+
+// toS3Notifications converts resolved notifications to an S3 notification configuration
+func toS3Notifications(notifications []notification) *s3.NotificationConfiguration {
+	config := &s3.NotificationConfiguration{}
+	for _, n := range notifications {
+		id, events, filter := aws.String(n.ID), aws.StringSlice(n.Events), toS3NotificationFilter(n)
+		switch n.Type {
+		case notificationQueue:
+			config.QueueConfigurations = append(config.QueueConfigurations, &s3.QueueConfiguration{
+				Id: id, QueueArn: aws.String(n.ARN), Events: events, Filter: filter,
+			})
+		case notificationTopic:
+			config.TopicConfigurations = append(config.TopicConfigurations, &s3.TopicConfiguration{
+				Id: id, TopicArn: aws.String(n.ARN), Events: events, Filter: filter,
+			})
+		case notificationLambda:
+			config.LambdaFunctionConfigurations = append(config.LambdaFunctionConfigurations, &s3.LambdaFunctionConfiguration{
+				Id: id, LambdaFunctionArn: aws.String(n.ARN), Events: events, Filter: filter,
+			})
+		}
+	}
+	return config
+}
+
+// fromS3Notification converts the parts of an S3 notification to its comparable form
+func fromS3Notification(id *string, notificationType string, arn *string, events []*string, filter *s3.NotificationConfigurationFilter) notification {
+	n := notification{
+		ID:     aws.StringValue(id),
+		Type:   notificationType,
+		ARN:    aws.StringValue(arn),
+		Events: aws.StringValueSlice(events),
+	}
+	sort.Strings(n.Events)
+	if filter != nil && filter.Key != nil {
+		for _, rule := range filter.Key.FilterRules {
+			// Filter rule names are case insensitive
+			switch strings.ToLower(aws.StringValue(rule.Name)) {
+			case s3.FilterRuleNamePrefix:
+				n.Prefix = aws.StringValue(rule.Value)
+			case s3.FilterRuleNameSuffix:
+				n.Suffix = aws.StringValue(rule.Value)
+			}
+		}
+	}
+	return n
+}
+
+// getBucketNotifications retrieves the notifications of the S3 bucket, sorted by ID
+func getBucketNotifications(svc *s3.S3, bucketName string) ([]notification, error) {
+	result, err := svc.GetBucketNotificationConfiguration(&s3.GetBucketNotificationConfigurationRequest{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	notifications := []notification{}
+	for _, c := range result.QueueConfigurations {
+		notifications = append(notifications, fromS3Notification(c.Id, notificationQueue, c.QueueArn, c.Events, c.Filter))
+	}
+	for _, c := range result.TopicConfigurations {
+		notifications = append(notifications, fromS3Notification(c.Id, notificationTopic, c.TopicArn, c.Events, c.Filter))
+	}
+	for _, c := range result.LambdaFunctionConfigurations {
+		notifications = append(notifications, fromS3Notification(c.Id, notificationLambda, c.LambdaFunctionArn, c.Events, c.Filter))
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+	return notifications, nil
+}
+
+// reconcileNotifications applies the desired event notifications to the S3 bucket.
+// The targets must allow S3 to send them events, S3 validates this when the notifications are applied.
+func reconcileNotifications(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	if len(s3Bucket.Spec.Notifications) == 0 {
+		if !s3Bucket.Status.NotificationsManaged {
+			return nil
+		}
+		// The notifications were removed from the spec, an empty configuration removes the ones the operator applied
+		_, err := svc.PutBucketNotificationConfiguration(&s3.PutBucketNotificationConfigurationInput{
+			Bucket:                    aws.String(s3Bucket.Name),
+			NotificationConfiguration: &s3.NotificationConfiguration{},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to clear bucket notifications: %w", err)
+		}
+		s3Bucket.Status.NotificationsManaged = false
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' notifications cleared\n", s3Bucket.Name)))
+		return nil
+	}
+	s3Bucket.Status.NotificationsManaged = true
+	desired, err := desiredNotifications(clients.SQS, s3Bucket)
+	if err != nil {
+		return err
+	}
+	observed, err := getBucketNotifications(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket notifications: %w", err)
+	}
+	if equality.Semantic.DeepEqual(desired, observed) {
+		return nil
+	}
+
+	_, err = svc.PutBucketNotificationConfiguration(&s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(s3Bucket.Name),
+		NotificationConfiguration: toS3Notifications(desired),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket notifications: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' notifications updated with %d targets\n", s3Bucket.Name, len(desired))))
+	return nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoObjectLockConfiguration is returned by GetObjectLockConfiguration for buckets without Object Lock
+const errCodeNoObjectLockConfiguration = "ObjectLockConfigurationNotFoundError"
+
+// getObjectLockConfiguration retrieves the Object Lock configuration of the S3 bucket, nil if Object Lock is not enabled
+func getObjectLockConfiguration(svc *s3.S3, bucketName string) (*s3.ObjectLockConfiguration, error) {
+	result, err := svc.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoObjectLockConfiguration {
+			return nil, nil
+		}
+		return nil, err
+	}
+	config := result.ObjectLockConfiguration
+	if config == nil || aws.StringValue(config.ObjectLockEnabled) != s3.ObjectLockEnabledEnabled {
+		return nil, nil
+	}
+	return config, nil
+}
+
+// defaultRetentionMatches compares the desired default retention with the observed Object Lock rule
+func defaultRetentionMatches(desired *bucketv1.ObjectLockRetention, observed *s3.ObjectLockRule) bool {
+	if observed == nil || observed.DefaultRetention == nil {
+		return desired == nil
+	}
+	if desired == nil {
+		return false
+	}
+	retention := observed.DefaultRetention
+	return desired.Mode == aws.StringValue(retention.Mode) &&
+		desired.Days == aws.Int64Value(retention.Days) &&
+		desired.Years == aws.Int64Value(retention.Years)
+}
+
+// reconcileObjectLock applies the default retention of the S3Bucket to the S3 bucket.
+// Object Lock can't be turned on or off for an existing S3 bucket, such changes are rejected.
+func reconcileObjectLock(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	observed, err := getObjectLockConfiguration(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get object lock configuration: %w", err)
+	}
+	s3Bucket.Status.ObjectLockEnabled = observed != nil
+	objectLock := s3Bucket.Spec.ObjectLock
+	if objectLock == nil {
+		return nil
+	}
+	if objectLock.Enabled && observed == nil {
+		return &reasonError{
+			reason: ReasonObjectLockImmutable,
+			err:    fmt.Errorf("object lock can only be enabled when the s3 bucket is created"),
+		}
+	}
+	if !objectLock.Enabled && observed != nil {
+		return &reasonError{
+			reason: ReasonObjectLockImmutable,
+			err:    fmt.Errorf("object lock cannot be disabled once enabled"),
+		}
+	}
+	if !objectLock.Enabled || defaultRetentionMatches(objectLock.DefaultRetention, observed.Rule) {
+		return nil
+	}
+
+	config := &s3.ObjectLockConfiguration{
+		ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+	}
+	if retention := objectLock.DefaultRetention; retention != nil {
+		config.Rule = &s3.ObjectLockRule{
+			DefaultRetention: &s3.DefaultRetention{
+				Mode: aws.String(retention.Mode),
+			},
+		}
+		if retention.Days > 0 {
+			config.Rule.DefaultRetention.Days = aws.Int64(retention.Days)
+		}
+		if retention.Years > 0 {
+			config.Rule.DefaultRetention.Years = aws.Int64(retention.Years)
+		}
+	}
+	_, err = svc.PutObjectLockConfiguration(&s3.PutObjectLockConfigurationInput{
+		Bucket:                  aws.String(s3Bucket.Name),
+		ObjectLockConfiguration: config,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object lock configuration: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' object lock default retention updated\n", s3Bucket.Name)))
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoSuchBucketPolicy is returned by GetBucketPolicy for buckets without a bucket policy
+const errCodeNoSuchBucketPolicy = "NoSuchBucketPolicy"
+
+// userIDPattern matches the aws:userid of all sessions of the identity with the given unique ID.
+// Roles have a <role id>:<session name> user ID, users and accounts a plain one.
+func userIDPattern(userID string) string {
+	if i := strings.Index(userID, ":"); i >= 0 {
+		return userID[:i] + ":*"
+	}
+	return userID
+}
+
+// offlinePolicy renders the deny-all bucket policy of S3 buckets taken offline.
+// Managing the bucket policy stays allowed, so the S3 bucket can be brought back online,
+// and the operator itself is exempted, so it can still empty and delete the S3 bucket.
+func offlinePolicy(bucketName string, operatorUserID string) string {
+	policy := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Sid":       "S3BucketOffline",
+			"Effect":    "Deny",
+			"Principal": "*",
+			"NotAction": []string{"s3:GetBucketPolicy", "s3:PutBucketPolicy", "s3:DeleteBucketPolicy"},
+			"Resource":  []string{bucketARN(bucketName), bucketARN(bucketName) + "/*"},
+			"Condition": map[string]interface{}{
+				"StringNotLike": map[string]interface{}{"aws:userid": userIDPattern(operatorUserID)},
+			},
+		}},
+	}
+	data, _ := json.Marshal(policy)
+	return string(data)
+}
+
+// getBucketPolicy retrieves the bucket policy of the S3 bucket, an empty string if it has none
+func getBucketPolicy(svc *s3.S3, bucketName string) (string, error) {
+	result, err := svc.GetBucketPolicy(&s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeNoSuchBucketPolicy {
+			return "", nil
+		}
+		return "", err
+	}
+	return aws.StringValue(result.Policy), nil
+}
+
+// putBucketPolicy sets the bucket policy of the S3 bucket, an empty policy deletes it
+func putBucketPolicy(svc *s3.S3, bucketName string, policy string) error {
+	if policy == "" {
+		_, err := svc.DeleteBucketPolicy(&s3.DeleteBucketPolicyInput{
+			Bucket: aws.String(bucketName),
+		})
+		return err
+	}
+	_, err := svc.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucketName),
+		Policy: aws.String(policy),
+	})
+	return err
+}
+
+// isBucketTakenOffline checks whether the S3Bucket was taken offline by the operator
+func isBucketTakenOffline(s3Bucket *bucketv1.S3Bucket) bool {
+	_, ok := s3Bucket.Annotations[bucketv1.PreOfflinePolicyAnnotation]
+	return ok
+}
+
+// takeBucketOffline remembers the current bucket policy of the S3 bucket and replaces it with a deny-all policy
+func (r *S3BucketReconciler) takeBucketOffline(ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	operatorUserID, err := clients.CallerUserID()
+	if err != nil {
+		return err
+	}
+	denyAll := offlinePolicy(s3Bucket.Name, operatorUserID)
+	current, err := getBucketPolicy(svc, s3Bucket.Name)
+	if err != nil {
+		return err
+	}
+	if policiesEqual(current, denyAll) {
+		return nil
+	}
+
+	// Persist the previous policy before replacing it, so it can't get lost
+	if !isBucketTakenOffline(s3Bucket) {
+		if s3Bucket.Annotations == nil {
+			s3Bucket.Annotations = map[string]string{}
+		}
+		s3Bucket.Annotations[bucketv1.PreOfflinePolicyAnnotation] = current
+		if err := r.updateKeepingStatus(ctx, s3Bucket); err != nil {
+			return err
+		}
+	}
+
+	if err := putBucketPolicy(svc, s3Bucket.Name, denyAll); err != nil {
+		return err
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' taken offline\n", s3Bucket.Name)))
+	return nil
+}
+
+// bringBucketOnline restores the bucket policy the S3 bucket had before it was taken offline.
+// An S3 bucket that no longer exists has no policy to restore.
+func (r *S3BucketReconciler) bringBucketOnline(ctx context.Context, svc *s3.S3, s3Bucket *bucketv1.S3Bucket) error {
+	previous := s3Bucket.Annotations[bucketv1.PreOfflinePolicyAnnotation]
+	if err := putBucketPolicy(svc, s3Bucket.Name, previous); err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != s3.ErrCodeNoSuchBucket {
+			return err
+		}
+	}
+
+	delete(s3Bucket.Annotations, bucketv1.PreOfflinePolicyAnnotation)
+	if err := r.updateKeepingStatus(ctx, s3Bucket); err != nil {
+		return err
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' brought back online\n", s3Bucket.Name)))
+	return nil
+}
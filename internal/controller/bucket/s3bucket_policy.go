@@ -0,0 +1,447 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// policyAccessLevels maps the access levels of policy grants to S3 actions
+var policyAccessLevels = map[string][]string{
+	"read":   {"s3:GetObject", "s3:GetObjectVersion"},
+	"write":  {"s3:PutObject", "s3:AbortMultipartUpload"},
+	"delete": {"s3:DeleteObject", "s3:DeleteObjectVersion"},
+	"list":   {"s3:ListBucket", "s3:ListBucketVersions"},
+}
+
+// bucketARN returns the ARN of the S3 bucket
+func bucketARN(bucketName string) string {
+	return "arn:aws:s3:::" + bucketName
+}
+
+// bucketLevelActions are the S3 actions applying to the bucket rather than to its objects
+var bucketLevelActions = map[string]bool{
+	"s3:CreateBucket":                       true,
+	"s3:DeleteBucket":                       true,
+	"s3:ListBucket":                         true,
+	"s3:ListBucketVersions":                 true,
+	"s3:ListBucketMultipartUploads":         true,
+	"s3:GetBucketLocation":                  true,
+	"s3:GetBucketAcl":                       true,
+	"s3:PutBucketAcl":                       true,
+	"s3:GetBucketCORS":                      true,
+	"s3:PutBucketCORS":                      true,
+	"s3:GetBucketPolicy":                    true,
+	"s3:PutBucketPolicy":                    true,
+	"s3:DeleteBucketPolicy":                 true,
+	"s3:GetBucketPolicyStatus":              true,
+	"s3:GetBucketVersioning":                true,
+	"s3:PutBucketVersioning":                true,
+	"s3:GetBucketLogging":                   true,
+	"s3:PutBucketLogging":                   true,
+	"s3:GetBucketNotification":              true,
+	"s3:PutBucketNotification":              true,
+	"s3:GetBucketTagging":                   true,
+	"s3:PutBucketTagging":                   true,
+	"s3:GetBucketWebsite":                   true,
+	"s3:PutBucketWebsite":                   true,
+	"s3:DeleteBucketWebsite":                true,
+	"s3:GetBucketRequestPayment":            true,
+	"s3:PutBucketRequestPayment":            true,
+	"s3:GetBucketObjectLockConfiguration":   true,
+	"s3:PutBucketObjectLockConfiguration":   true,
+	"s3:GetBucketOwnershipControls":         true,
+	"s3:PutBucketOwnershipControls":         true,
+	"s3:GetBucketPublicAccessBlock":         true,
+	"s3:PutBucketPublicAccessBlock":         true,
+	"s3:GetLifecycleConfiguration":          true,
+	"s3:PutLifecycleConfiguration":          true,
+	"s3:GetEncryptionConfiguration":         true,
+	"s3:PutEncryptionConfiguration":         true,
+	"s3:GetReplicationConfiguration":        true,
+	"s3:PutReplicationConfiguration":        true,
+	"s3:GetAccelerateConfiguration":         true,
+	"s3:PutAccelerateConfiguration":         true,
+	"s3:GetAnalyticsConfiguration":          true,
+	"s3:PutAnalyticsConfiguration":          true,
+	"s3:GetInventoryConfiguration":          true,
+	"s3:PutInventoryConfiguration":          true,
+	"s3:GetMetricsConfiguration":            true,
+	"s3:PutMetricsConfiguration":            true,
+	"s3:GetIntelligentTieringConfiguration": true,
+	"s3:PutIntelligentTieringConfiguration": true,
+}
+
+// isBucketAction checks whether the S3 action applies to the bucket rather than to its objects
+func isBucketAction(action string) bool {
+	return bucketLevelActions[action]
+}
+
+// grantStatements renders the statements of a policy grant, one for object actions and one for bucket actions
+func grantStatements(bucketName string, grant bucketv1.PolicyGrant) ([]map[string]interface{}, error) {
+	objectActions, bucketActions := []string{}, []string{}
+	for _, action := range grant.Actions {
+		actions, ok := policyAccessLevels[strings.ToLower(action)]
+		if !ok {
+			if !strings.HasPrefix(action, "s3:") {
+				return nil, fmt.Errorf("unknown action %q in grant %q", action, grant.Sid)
+			}
+			actions = []string{action}
+		}
+		for _, a := range actions {
+			switch {
+			case strings.Contains(a, "*"):
+				// Wildcards may match both bucket and object actions
+				objectActions = append(objectActions, a)
+				bucketActions = append(bucketActions, a)
+			case isBucketAction(a):
+				bucketActions = append(bucketActions, a)
+			default:
+				objectActions = append(objectActions, a)
+			}
+		}
+	}
+
+	var principal interface{} = map[string][]string{"AWS": grant.Principals}
+	if len(grant.Principals) == 1 && grant.Principals[0] == "*" {
+		principal = "*"
+	}
+	effect := grant.Effect
+	if effect == "" {
+		effect = "Allow"
+	}
+	statement := func(sidSuffix string, actions []string, resource string, conditions map[string]map[string][]string) map[string]interface{} {
+		statement := map[string]interface{}{
+			"Effect":    effect,
+			"Principal": principal,
+			"Action":    actions,
+			"Resource":  resource,
+		}
+		if grant.Sid != "" {
+			statement["Sid"] = grant.Sid + sidSuffix
+		}
+		if len(conditions) > 0 {
+			statement["Condition"] = conditions
+		}
+		return statement
+	}
+
+	statements := []map[string]interface{}{}
+	if len(objectActions) > 0 {
+		resource := bucketARN(bucketName) + "/" + grant.Prefix + "*"
+		statements = append(statements, statement("Objects", objectActions, resource, grant.Conditions))
+	}
+	if len(bucketActions) > 0 {
+		conditions := grant.Conditions
+		// Listing is limited to the prefix of the grant
+		if grant.Prefix != "" {
+			conditions = map[string]map[string][]string{}
+			for operator, keys := range grant.Conditions {
+				conditions[operator] = map[string][]string{}
+				for key, values := range keys {
+					conditions[operator][key] = values
+				}
+			}
+			if conditions["StringLike"] == nil {
+				conditions["StringLike"] = map[string][]string{}
+			}
+			conditions["StringLike"]["s3:prefix"] = []string{grant.Prefix + "*"}
+		}
+		statements = append(statements, statement("Bucket", bucketActions, bucketARN(bucketName), conditions))
+	}
+	return statements, nil
+}
+
+// policySetKeys are the statement keys holding sets of strings, AWS returns sets of one as a plain string
+var policySetKeys = map[string]bool{"Action": true, "NotAction": true, "Resource": true, "NotResource": true}
+
+// accountIDRegexp matches a bare account ID, AWS returns account principals as the ARN of the account root
+var accountIDRegexp = regexp.MustCompile(`^[0-9]{12}$`)
+
+// stringSet converts a string or a list of strings to a sorted list of strings, other values are returned as is
+func stringSet(value interface{}, normalize func(string) string) interface{} {
+	values := []string{}
+	switch v := value.(type) {
+	case string:
+		values = append(values, normalize(v))
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return value
+			}
+			values = append(values, normalize(s))
+		}
+	default:
+		return value
+	}
+	sort.Strings(values)
+	return values
+}
+
+// sameString leaves a policy value as is
+func sameString(value string) string {
+	return value
+}
+
+// principalARN converts the account IDs of AWS principals to the ARN of the account root, as AWS does
+func principalARN(principal string) string {
+	if accountIDRegexp.MatchString(principal) {
+		return "arn:aws:iam::" + principal + ":root"
+	}
+	return principal
+}
+
+// normalizePrincipal converts a Principal or NotPrincipal of a statement to the form AWS returns.
+// {"AWS": "*"} is the same as "*".
+func normalizePrincipal(principal interface{}) interface{} {
+	principals, ok := principal.(map[string]interface{})
+	if !ok {
+		return principal
+	}
+	if value, ok := principals["AWS"]; ok && len(principals) == 1 && reflect.DeepEqual(stringSet(value, sameString), []string{"*"}) {
+		return "*"
+	}
+	normalized := map[string]interface{}{}
+	for kind, value := range principals {
+		if kind == "AWS" {
+			normalized[kind] = stringSet(value, principalARN)
+		} else {
+			normalized[kind] = stringSet(value, sameString)
+		}
+	}
+	return normalized
+}
+
+// normalizeStatement converts a policy statement to a canonical form, so statements can be compared with the ones AWS returns
+func normalizeStatement(statement interface{}) interface{} {
+	fields, ok := statement.(map[string]interface{})
+	if !ok {
+		return statement
+	}
+	normalized := map[string]interface{}{}
+	for key, value := range fields {
+		switch {
+		case policySetKeys[key]:
+			normalized[key] = stringSet(value, sameString)
+		case key == "Principal" || key == "NotPrincipal":
+			normalized[key] = normalizePrincipal(value)
+		case key == "Condition":
+			operators, ok := value.(map[string]interface{})
+			if !ok {
+				normalized[key] = value
+				continue
+			}
+			conditions := map[string]interface{}{}
+			for operator, keys := range operators {
+				values, ok := keys.(map[string]interface{})
+				if !ok {
+					conditions[operator] = keys
+					continue
+				}
+				conditionValues := map[string]interface{}{}
+				for conditionKey, conditionValue := range values {
+					conditionValues[conditionKey] = stringSet(conditionValue, sameString)
+				}
+				conditions[operator] = conditionValues
+			}
+			normalized[key] = conditions
+		default:
+			normalized[key] = value
+		}
+	}
+	return normalized
+}
+
+// normalizePolicy converts a parsed bucket policy to a canonical form, a single statement becomes a list of one
+func normalizePolicy(policy interface{}) interface{} {
+	document, ok := policy.(map[string]interface{})
+	if !ok {
+		return policy
+	}
+	normalized := map[string]interface{}{}
+	for key, value := range document {
+		normalized[key] = value
+	}
+	statements, ok := document["Statement"].([]interface{})
+	if !ok {
+		statements = []interface{}{document["Statement"]}
+	}
+	normalizedStatements := []interface{}{}
+	for _, statement := range statements {
+		normalizedStatements = append(normalizedStatements, normalizeStatement(statement))
+	}
+	normalized["Statement"] = normalizedStatements
+	return normalized
+}
+
+// policyStatements returns the statements of a parsed bucket policy, a single statement becomes a list of one
+func policyStatements(policy map[string]interface{}) []interface{} {
+	switch statements := policy["Statement"].(type) {
+	case []interface{}:
+		return statements
+	case nil:
+		return []interface{}{}
+	default:
+		return []interface{}{statements}
+	}
+}
+
+// isLogDeliveryStatement checks whether the policy statement grants log delivery, see grantLogDelivery
+func isLogDeliveryStatement(statement interface{}) bool {
+	fields, ok := statement.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	sid, _ := fields["Sid"].(string)
+	return strings.HasPrefix(sid, logDeliverySidPrefix)
+}
+
+// withLogDeliveryStatements adds the log delivery statements of the current bucket policy to the desired one.
+// They are managed by the S3Buckets logging to this bucket and must survive the updates of its policy.
+func withLogDeliveryStatements(desired string, current string) (string, error) {
+	if current == "" {
+		return desired, nil
+	}
+	var currentPolicy map[string]interface{}
+	if err := json.Unmarshal([]byte(current), &currentPolicy); err != nil {
+		return desired, nil
+	}
+	logDelivery := []interface{}{}
+	for _, statement := range policyStatements(currentPolicy) {
+		if isLogDeliveryStatement(statement) {
+			logDelivery = append(logDelivery, statement)
+		}
+	}
+	if len(logDelivery) == 0 {
+		return desired, nil
+	}
+
+	desiredPolicy := map[string]interface{}{"Version": "2012-10-17"}
+	if desired != "" {
+		if err := json.Unmarshal([]byte(desired), &desiredPolicy); err != nil {
+			return "", fmt.Errorf("invalid bucket policy: %w", err)
+		}
+	}
+	statements := []interface{}{}
+	for _, statement := range policyStatements(desiredPolicy) {
+		if !isLogDeliveryStatement(statement) {
+			statements = append(statements, statement)
+		}
+	}
+	desiredPolicy["Statement"] = append(statements, logDelivery...)
+	data, err := json.Marshal(desiredPolicy)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// policiesEqual compares two JSON bucket policies, ignoring key order, whitespace and the normalization AWS applies
+func policiesEqual(a string, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	var policyA, policyB interface{}
+	if json.Unmarshal([]byte(a), &policyA) != nil || json.Unmarshal([]byte(b), &policyB) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(normalizePolicy(policyA), normalizePolicy(policyB))
+}
+
+// renderBucketPolicy renders the bucket policy of the S3Bucket spec, an empty string removes the bucket policy
+func renderBucketPolicy(s3Bucket *bucketv1.S3Bucket) (string, error) {
+	policy := s3Bucket.Spec.Policy
+	if policy.Raw != "" {
+		var document map[string]interface{}
+		if err := json.Unmarshal([]byte(policy.Raw), &document); err != nil {
+			return "", fmt.Errorf("invalid bucket policy: %w", err)
+		}
+		if _, ok := document["Statement"]; !ok {
+			return "", fmt.Errorf("invalid bucket policy: no Statement")
+		}
+		return policy.Raw, nil
+	}
+	if len(policy.Grants) == 0 {
+		return "", nil
+	}
+
+	statements := []map[string]interface{}{}
+	for _, grant := range policy.Grants {
+		grantStatements, err := grantStatements(s3Bucket.Name, grant)
+		if err != nil {
+			return "", err
+		}
+		statements = append(statements, grantStatements...)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// reconcilePolicy applies the desired bucket policy to the S3 bucket, unless it is semantically equal to the current one.
+// Once the policy is removed from the spec, the bucket policy the operator applied is removed as well.
+func reconcilePolicy(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	if s3Bucket.Spec.Policy == nil && !s3Bucket.Status.PolicyManaged {
+		return nil
+	}
+	desired := ""
+	if s3Bucket.Spec.Policy != nil {
+		s3Bucket.Status.PolicyManaged = true
+		rendered, err := renderBucketPolicy(s3Bucket)
+		if err != nil {
+			return err
+		}
+		desired = rendered
+	}
+	current, err := getBucketPolicy(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket policy: %w", err)
+	}
+	desired, err = withLogDeliveryStatements(desired, current)
+	if err != nil {
+		return err
+	}
+	if !policiesEqual(current, desired) {
+		if err := putBucketPolicy(svc, s3Bucket.Name, desired); err != nil {
+			return fmt.Errorf("failed to put bucket policy: %w", err)
+		}
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' policy updated\n", s3Bucket.Name)))
+	}
+	// The log delivery statements stay when the policy is removed from the spec, they belong to other S3Buckets
+	if s3Bucket.Spec.Policy == nil {
+		s3Bucket.Status.PolicyManaged = false
+	}
+	return nil
+}
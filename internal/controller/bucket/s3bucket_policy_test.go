@@ -0,0 +1,199 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+var _ = Describe("S3Bucket policy", func() {
+	DescribeTable("comparing policies",
+		func(a, b string, want bool) {
+			Expect(policiesEqual(a, b)).To(Equal(want))
+			Expect(policiesEqual(b, a)).To(Equal(want))
+		},
+		Entry("both empty", "", "", true),
+		Entry("one empty", `{"Version":"2012-10-17","Statement":[]}`, "", false),
+		Entry("key order and whitespace",
+			`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":["s3:GetObject"],"Resource":"arn:aws:s3:::b/*"}]}`,
+			`{ "Statement": [ { "Resource": "arn:aws:s3:::b/*", "Action": ["s3:GetObject"], "Principal": "*", "Effect": "Allow" } ], "Version": "2012-10-17" }`,
+			true),
+		Entry("single action returned as a string",
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":["s3:GetObject"],"Resource":["arn:aws:s3:::b/*"]}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			true),
+		Entry("single principal returned as a string",
+			`{"Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::123456789012:role/reader"]},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:role/reader"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			true),
+		Entry("account ID returned as the ARN of the account root",
+			`{"Statement":[{"Effect":"Allow","Principal":{"AWS":["123456789012","arn:aws:iam::210987654321:root"]},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::210987654321:root","arn:aws:iam::123456789012:root"]},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			true),
+		Entry("wildcard AWS principal",
+			`{"Statement":[{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			true),
+		Entry("single condition value returned as a string",
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:ListBucket","Resource":"arn:aws:s3:::b","Condition":{"StringLike":{"s3:prefix":["logs/*"]}}}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:ListBucket","Resource":"arn:aws:s3:::b","Condition":{"StringLike":{"s3:prefix":"logs/*"}}}]}`,
+			true),
+		Entry("single statement object",
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}}`,
+			true),
+		Entry("action order",
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":["s3:GetObject","s3:PutObject"],"Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":["s3:PutObject","s3:GetObject"],"Resource":"arn:aws:s3:::b/*"}]}`,
+			true),
+		Entry("different actions",
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:PutObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			false),
+		Entry("different principals",
+			`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::210987654321:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			false),
+		Entry("different effects",
+			`{"Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			`{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			false),
+	)
+
+	// Rendered grants must compare equal to the normalized policy AWS returns for them,
+	// so reconcilePolicy doesn't put the bucket policy on every reconcile
+	DescribeTable("matching the policy AWS returns for rendered grants",
+		func(grants []bucketv1.PolicyGrant, aws string) {
+			s3Bucket := &bucketv1.S3Bucket{
+				ObjectMeta: metav1.ObjectMeta{Name: "bucket"},
+				Spec:       bucketv1.S3BucketSpec{Policy: &bucketv1.BucketPolicy{Grants: grants}},
+			}
+			rendered, err := renderBucketPolicy(s3Bucket)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policiesEqual(rendered, aws)).To(BeTrue(), "rendered policy %s doesn't match %s", rendered, aws)
+		},
+		Entry("single principal and action", []bucketv1.PolicyGrant{{
+			Sid:        "Reader",
+			Principals: []string{"123456789012"},
+			Actions:    []string{"s3:GetObject"},
+		}}, `{"Version":"2012-10-17","Statement":[{"Sid":"ReaderObjects","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::bucket/*"}]}`),
+		Entry("access level with prefix", []bucketv1.PolicyGrant{{
+			Sid:        "Logs",
+			Principals: []string{"arn:aws:iam::123456789012:role/logs"},
+			Actions:    []string{"list"},
+			Prefix:     "logs/",
+		}}, `{"Version":"2012-10-17","Statement":[{"Sid":"LogsBucket","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:role/logs"},"Action":["s3:ListBucketVersions","s3:ListBucket"],"Resource":"arn:aws:s3:::bucket","Condition":{"StringLike":{"s3:prefix":"logs/*"}}}]}`),
+		Entry("public read", []bucketv1.PolicyGrant{{
+			Principals: []string{"*"},
+			Actions:    []string{"read"},
+		}}, `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":["s3:GetObjectVersion","s3:GetObject"],"Resource":"arn:aws:s3:::bucket/*"}]}`),
+	)
+
+	DescribeTable("telling bucket actions from object actions",
+		func(action string, want bool) {
+			Expect(isBucketAction(action)).To(Equal(want))
+		},
+		Entry("list bucket", "s3:ListBucket", true),
+		Entry("lifecycle configuration", "s3:GetLifecycleConfiguration", true),
+		Entry("encryption configuration", "s3:PutEncryptionConfiguration", true),
+		Entry("replication configuration", "s3:GetReplicationConfiguration", true),
+		Entry("get object", "s3:GetObject", false),
+		Entry("list multipart upload parts", "s3:ListMultipartUploadParts", false),
+		Entry("replicate object", "s3:ReplicateObject", false),
+	)
+
+	It("renders the offline policy like AWS returns it", func() {
+		aws := `{"Version":"2012-10-17","Statement":[{"Sid":"S3BucketOffline","Effect":"Deny","Principal":"*",` +
+			`"NotAction":["s3:GetBucketPolicy","s3:PutBucketPolicy","s3:DeleteBucketPolicy"],` +
+			`"Resource":["arn:aws:s3:::bucket/*","arn:aws:s3:::bucket"],` +
+			`"Condition":{"StringNotLike":{"aws:userid":"AROAEXAMPLE:*"}}}]}`
+		rendered := offlinePolicy("bucket", "AROAEXAMPLE:operator")
+		Expect(policiesEqual(rendered, aws)).To(BeTrue(), "offline policy %s doesn't match %s", rendered, aws)
+	})
+
+	Context("removing the policy from the spec", func() {
+		var s3 *fakeS3
+
+		BeforeEach(func() {
+			s3 = newFakeS3()
+			s3.addBucket("removed-policy", 0)
+		})
+
+		AfterEach(func() {
+			s3.close()
+		})
+
+		grant := `{"Sid":"Read","Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::removed-policy/*"}`
+		logDelivery := `{"Sid":"S3ServerAccessLogssource","Effect":"Allow","Principal":{"Service":"logging.s3.amazonaws.com"},"Action":"s3:PutObject","Resource":"arn:aws:s3:::removed-policy/logs/*"}`
+
+		DescribeTable("removing the bucket policy the operator applied",
+			func(managed bool, current string, want string) {
+				s3.setPolicy("removed-policy", current)
+				s3Bucket := &bucketv1.S3Bucket{
+					ObjectMeta: metav1.ObjectMeta{Name: "removed-policy"},
+					Status:     bucketv1.S3BucketStatus{PolicyManaged: managed},
+				}
+				Expect(reconcilePolicy(nil, context.Background(), s3.clients(), s3Bucket)).To(Succeed())
+				Expect(policiesEqual(s3.bucketPolicy("removed-policy"), want)).To(BeTrue(),
+					"got %s, want %s", s3.bucketPolicy("removed-policy"), want)
+				Expect(s3Bucket.Status.PolicyManaged).To(BeFalse())
+			},
+			Entry("deletes the policy",
+				true, `{"Version":"2012-10-17","Statement":[`+grant+`]}`, ""),
+			Entry("keeps the log delivery statements",
+				true, `{"Version":"2012-10-17","Statement":[`+grant+`,`+logDelivery+`]}`,
+				`{"Version":"2012-10-17","Statement":[`+logDelivery+`]}`),
+			Entry("leaves policies the operator didn't apply alone",
+				false, `{"Version":"2012-10-17","Statement":[`+grant+`]}`,
+				`{"Version":"2012-10-17","Statement":[`+grant+`]}`),
+		)
+	})
+
+	Context("keeping the log delivery statements", func() {
+		logDelivery := `{"Sid":"S3ServerAccessLogssource","Effect":"Allow","Principal":{"Service":"logging.s3.amazonaws.com"},"Action":"s3:PutObject","Resource":"arn:aws:s3:::target/logs/*"}`
+		grant := `{"Sid":"Read","Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::target/*"}`
+
+		DescribeTable("merging the desired policy with the current one",
+			func(desired, current, want string) {
+				got, err := withLogDeliveryStatements(desired, current)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(policiesEqual(got, want)).To(BeTrue(), "got %s, want %s", got, want)
+			},
+			Entry("no current policy",
+				`{"Version":"2012-10-17","Statement":[`+grant+`]}`, "",
+				`{"Version":"2012-10-17","Statement":[`+grant+`]}`),
+			Entry("current policy without log delivery",
+				`{"Version":"2012-10-17","Statement":[`+grant+`]}`,
+				`{"Version":"2012-10-17","Statement":[{"Sid":"Old","Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"arn:aws:s3:::target/*"}]}`,
+				`{"Version":"2012-10-17","Statement":[`+grant+`]}`),
+			Entry("log delivery is kept",
+				`{"Version":"2012-10-17","Statement":[`+grant+`]}`,
+				`{"Version":"2012-10-17","Statement":[`+logDelivery+`]}`,
+				`{"Version":"2012-10-17","Statement":[`+grant+`,`+logDelivery+`]}`),
+			Entry("log delivery is kept when the policy is removed", "",
+				`{"Version":"2012-10-17","Statement":[`+grant+`,`+logDelivery+`]}`,
+				`{"Version":"2012-10-17","Statement":[`+logDelivery+`]}`),
+		)
+	})
+})
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoSuchPublicAccessBlock is returned by GetPublicAccessBlock for buckets without public access block
+const errCodeNoSuchPublicAccessBlock = "NoSuchPublicAccessBlockConfiguration"
+
+// boolOrTrue dereferences the setting, defaulting to true
+func boolOrTrue(value *bool) bool {
+	return value == nil || *value
+}
+
+// desiredPublicAccessBlock resolves the public access block of the S3Bucket spec.
+// Reports whether the spec turns off blocks that are kept on by the operator-wide enforcement.
+func (r *S3BucketReconciler) desiredPublicAccessBlock(s3Bucket *bucketv1.S3Bucket) (s3.PublicAccessBlockConfiguration, bool) {
+	spec := s3Bucket.Spec.PublicAccessBlock
+	if spec == nil {
+		spec = &bucketv1.PublicAccessBlock{}
+	}
+	desired := s3.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(boolOrTrue(spec.BlockPublicAcls)),
+		IgnorePublicAcls:      aws.Bool(boolOrTrue(spec.IgnorePublicAcls)),
+		BlockPublicPolicy:     aws.Bool(boolOrTrue(spec.BlockPublicPolicy)),
+		RestrictPublicBuckets: aws.Bool(boolOrTrue(spec.RestrictPublicBuckets)),
+	}
+	if !r.EnforcePublicAccessBlock || publicAccessBlockEqual(desired, allPublicAccessBlocked()) {
+		return desired, false
+	}
+	return allPublicAccessBlocked(), true
+}
+
+// allPublicAccessBlocked returns a public access block with all four blocks on
+func allPublicAccessBlocked() s3.PublicAccessBlockConfiguration {
+	return s3.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(true),
+		IgnorePublicAcls:      aws.Bool(true),
+		BlockPublicPolicy:     aws.Bool(true),
+		RestrictPublicBuckets: aws.Bool(true),
+	}
+}
+
+// publicAccessBlockEqual compares two public access blocks, missing settings are off
+func publicAccessBlockEqual(a s3.PublicAccessBlockConfiguration, b s3.PublicAccessBlockConfiguration) bool {
+	return aws.BoolValue(a.BlockPublicAcls) == aws.BoolValue(b.BlockPublicAcls) &&
+		aws.BoolValue(a.IgnorePublicAcls) == aws.BoolValue(b.IgnorePublicAcls) &&
+		aws.BoolValue(a.BlockPublicPolicy) == aws.BoolValue(b.BlockPublicPolicy) &&
+		aws.BoolValue(a.RestrictPublicBuckets) == aws.BoolValue(b.RestrictPublicBuckets)
+}
+
+// getPublicAccessBlock retrieves the public access block of the S3 bucket, all blocks off if it has none
+func getPublicAccessBlock(svc *s3.S3, bucketName string) (s3.PublicAccessBlockConfiguration, error) {
+	result, err := svc.GetPublicAccessBlock(&s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoSuchPublicAccessBlock {
+			return s3.PublicAccessBlockConfiguration{}, nil
+		}
+		return s3.PublicAccessBlockConfiguration{}, err
+	}
+	if result.PublicAccessBlockConfiguration == nil {
+		return s3.PublicAccessBlockConfiguration{}, nil
+	}
+	return *result.PublicAccessBlockConfiguration, nil
+}
+
+// reconcilePublicAccessBlock applies the desired public access block to the S3 bucket.
+// It runs before the bucket policy, so a public policy is only applied once public policies are unblocked.
+func reconcilePublicAccessBlock(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	desired, enforced := r.desiredPublicAccessBlock(s3Bucket)
+	observed, err := getPublicAccessBlock(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get public access block: %w", err)
+	}
+	if publicAccessBlockEqual(desired, observed) {
+		return nil
+	}
+
+	if enforced {
+		r.Recorder.Event(s3Bucket, corev1.EventTypeWarning, "PublicAccessBlockEnforced",
+			"Public access blocks cannot be turned off, the operator enforces all of them")
+	}
+	_, err = svc.PutPublicAccessBlock(&s3.PutPublicAccessBlockInput{
+		Bucket:                         aws.String(s3Bucket.Name),
+		PublicAccessBlockConfiguration: &desired,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put public access block: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' public access block updated\n", s3Bucket.Name)))
+	return nil
+}
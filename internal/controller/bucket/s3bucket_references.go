@@ -0,0 +1,53 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+// resolveValueReference reads the value referenced by ref from a Secret or ConfigMap in the namespace
+func (r *S3BucketReconciler) resolveValueReference(ctx context.Context, namespace string, ref *bucketv1.ValueReference) (string, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+	switch ref.Kind {
+	case "Secret":
+		secret := &corev1.Secret{}
+		if err := r.APIReader.Get(ctx, key, secret); err != nil {
+			return "", err
+		}
+		if value, ok := secret.Data[ref.Key]; ok {
+			return string(value), nil
+		}
+	case "ConfigMap":
+		configMap := &corev1.ConfigMap{}
+		if err := r.APIReader.Get(ctx, key, configMap); err != nil {
+			return "", err
+		}
+		if value, ok := configMap.Data[ref.Key]; ok {
+			return value, nil
+		}
+	default:
+		return "", fmt.Errorf("unsupported reference kind %q", ref.Kind)
+	}
+	return "", fmt.Errorf("key %q not found in %s %s", ref.Key, ref.Kind, ref.Name)
+}
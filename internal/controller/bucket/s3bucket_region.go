@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodePermanentRedirect is returned by S3 for requests sent to another region than the one of the bucket
+const errCodePermanentRedirect = "PermanentRedirect"
+
+// isRedirect checks whether S3 redirected the request to the region of the bucket
+func isRedirect(err error) bool {
+	var rerr awserr.RequestFailure
+	if errors.As(err, &rerr) && rerr.StatusCode() == http.StatusMovedPermanently {
+		return true
+	}
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == errCodePermanentRedirect
+}
+
+// regionalClients routes the clients to the region of the S3Bucket, the observed region wins over the desired one
+func regionalClients(clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) *s3config.Clients {
+	if s3Bucket.Status.Region != "" {
+		return clients.ForRegion(s3Bucket.Status.Region)
+	}
+	return clients.ForRegion(s3Bucket.Spec.Region)
+}
+
+// bucketClients returns the clients of the S3ProviderConfig and region of the S3Bucket
+func (r *S3BucketReconciler) bucketClients(ctx context.Context, s3Bucket *bucketv1.S3Bucket) (*s3config.Clients, error) {
+	clients, err := r.Clients.ForProvider(ctx, s3Bucket.Spec.ProviderConfigRef)
+	if err != nil {
+		return nil, err
+	}
+	return regionalClients(clients, s3Bucket), nil
+}
+
+// getBucketRegion retrieves the region of the S3 bucket with GetBucketLocation.
+// When S3 redirects the request, the region is taken from the x-amz-bucket-region header of the redirect.
+func getBucketRegion(ctx context.Context, svc *s3.S3, bucketName string) (string, error) {
+	result, err := svc.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err == nil {
+		return s3.NormalizeBucketLocation(aws.StringValue(result.LocationConstraint)), nil
+	}
+	if !isRedirect(err) {
+		return "", err
+	}
+	return s3manager.GetBucketRegionWithClient(ctx, svc, bucketName)
+}
+
+// reconcileRegion records the region of the S3 bucket in status and returns the clients of that region.
+// An S3 bucket outside of the desired region is an error, S3 buckets cannot be moved between regions.
+func reconcileRegion(ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) (*s3config.Clients, error) {
+	region, err := getBucketRegion(ctx, clients.S3, s3Bucket.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket location: %w", err)
+	}
+	if region != s3Bucket.Status.Region {
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' found in region %s\n", s3Bucket.Name, region)))
+	}
+	s3Bucket.Status.Region = region
+	if s3Bucket.Spec.Region != "" && region != s3Bucket.Spec.Region {
+		return nil, &reasonError{
+			reason: ReasonRegionMismatch,
+			err:    fmt.Errorf("s3 bucket is in region %s instead of %s, s3 buckets cannot be moved", region, s3Bucket.Spec.Region),
+		}
+	}
+	return clients.ForRegion(region), nil
+}
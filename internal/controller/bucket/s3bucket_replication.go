@@ -0,0 +1,406 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoReplicationConfiguration is returned by GetBucketReplication for buckets without replication
+const errCodeNoReplicationConfiguration = "ReplicationConfigurationNotFoundError"
+
+// replicationRolePolicyName is the name of the inline policy of the replication roles managed by the operator
+const replicationRolePolicyName = "s3bucket-replication"
+
+// replicationRule is the comparable form of a replication rule, resolved to its destination bucket
+type replicationRule struct {
+	ID                      string
+	Priority                int64
+	Disabled                bool
+	Prefix                  string
+	DeleteMarkerReplication bool
+	Destination             string
+	StorageClass            string
+}
+
+// replicationRoleName returns the name of the replication role managed for the S3 bucket, at most 64 characters
+func replicationRoleName(bucketName string) string {
+	name := "s3-replication-" + bucketName
+	if len(name) <= 64 {
+		return name
+	}
+	hash := sha256.Sum256([]byte(bucketName))
+	return name[:55] + "-" + hex.EncodeToString(hash[:])[:8]
+}
+
+// replicationRolePolicies renders the trust policy and the permissions policy of the replication role
+func replicationRolePolicies(bucketName string, destinations []string) (string, string) {
+	trust, _ := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "s3.amazonaws.com"},
+			"Action":    "sts:AssumeRole",
+		}},
+	})
+	destinationObjects := []string{}
+	for _, destination := range destinations {
+		destinationObjects = append(destinationObjects, bucketARN(destination)+"/*")
+	}
+	permissions, _ := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:GetReplicationConfiguration", "s3:ListBucket"},
+				"Resource": bucketARN(bucketName),
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:GetObjectVersionForReplication", "s3:GetObjectVersionAcl", "s3:GetObjectVersionTagging"},
+				"Resource": bucketARN(bucketName) + "/*",
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:ReplicateObject", "s3:ReplicateDelete", "s3:ReplicateTags"},
+				"Resource": destinationObjects,
+			},
+		},
+	})
+	return string(trust), string(permissions)
+}
+
+// isNoSuchEntity checks whether the IAM error reports a missing role or policy
+func isNoSuchEntity(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == iam.ErrCodeNoSuchEntityException
+}
+
+// ensureReplicationRole creates the replication role of the S3 bucket if needed and keeps its permissions
+// in line with the destinations. Returns the ARN of the role.
+func ensureReplicationRole(svc *iam.IAM, bucketName string, destinations []string) (string, error) {
+	roleName := replicationRoleName(bucketName)
+	trust, permissions := replicationRolePolicies(bucketName, destinations)
+
+	var roleARN string
+	role, err := svc.GetRole(&iam.GetRoleInput{RoleName: aws.String(roleName)})
+	switch {
+	case isNoSuchEntity(err):
+		created, err := svc.CreateRole(&iam.CreateRoleInput{
+			RoleName:                 aws.String(roleName),
+			AssumeRolePolicyDocument: aws.String(trust),
+			Description:              aws.String(fmt.Sprintf("Replication of S3 bucket %s", bucketName)),
+		})
+		if err != nil {
+			return "", err
+		}
+		roleARN = aws.StringValue(created.Role.Arn)
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("IAM role '%s' created for replication\n", roleName)))
+	case err != nil:
+		return "", err
+	default:
+		roleARN = aws.StringValue(role.Role.Arn)
+	}
+
+	current, err := svc.GetRolePolicy(&iam.GetRolePolicyInput{
+		RoleName:   aws.String(roleName),
+		PolicyName: aws.String(replicationRolePolicyName),
+	})
+	if err != nil && !isNoSuchEntity(err) {
+		return "", err
+	}
+	if err == nil {
+		// IAM returns policy documents URL-encoded
+		document, _ := url.QueryUnescape(aws.StringValue(current.PolicyDocument))
+		if policiesEqual(document, permissions) {
+			return roleARN, nil
+		}
+	}
+	_, err = svc.PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(replicationRolePolicyName),
+		PolicyDocument: aws.String(permissions),
+	})
+	if err != nil {
+		return "", err
+	}
+	return roleARN, nil
+}
+
+// deleteReplicationRole deletes the replication role the operator created for the S3 bucket, if any
+func deleteReplicationRole(svc *iam.IAM, bucketName string) error {
+	roleName := replicationRoleName(bucketName)
+	_, err := svc.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+		RoleName:   aws.String(roleName),
+		PolicyName: aws.String(replicationRolePolicyName),
+	})
+	if err != nil && !isNoSuchEntity(err) {
+		return err
+	}
+	_, err = svc.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String(roleName)})
+	if err != nil && !isNoSuchEntity(err) {
+		return err
+	}
+	return nil
+}
+
+// isReplicationRoleManaged checks whether the replication role of the S3Bucket was created by the operator
+func isReplicationRoleManaged(s3Bucket *bucketv1.S3Bucket) bool {
+	return strings.HasSuffix(s3Bucket.Status.ReplicationRoleARN, ":role/"+replicationRoleName(s3Bucket.Name))
+}
+
+// ensureDestinationVersioning enables versioning on the destination bucket, replication requires it at both ends
+func ensureDestinationVersioning(svc *s3.S3, destination *bucketv1.S3Bucket) error {
+	if destination.Spec.Versioning == bucketv1.VersioningSuspended {
+		return fmt.Errorf("replication destination S3Bucket %s suspends versioning", destination.Name)
+	}
+	result, err := svc.GetBucketVersioning(&s3.GetBucketVersioningInput{
+		Bucket: aws.String(destination.Name),
+	})
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(result.Status) == s3.BucketVersioningStatusEnabled {
+		return nil
+	}
+	_, err = svc.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket: aws.String(destination.Name),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(s3.BucketVersioningStatusEnabled),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' versioning enabled for replication\n", destination.Name)))
+	return nil
+}
+
+// toS3ReplicationRule converts a resolved replication rule to an S3 replication rule
+func toS3ReplicationRule(rule replicationRule) *s3.ReplicationRule {
+	s3Rule := &s3.ReplicationRule{
+		ID:       aws.String(rule.ID),
+		Priority: aws.Int64(rule.Priority),
+		Status:   aws.String(s3.ReplicationRuleStatusEnabled),
+		Filter:   &s3.ReplicationRuleFilter{Prefix: aws.String(rule.Prefix)},
+		DeleteMarkerReplication: &s3.DeleteMarkerReplication{
+			Status: aws.String(s3.DeleteMarkerReplicationStatusDisabled),
+		},
+		Destination: &s3.Destination{Bucket: aws.String(bucketARN(rule.Destination))},
+	}
+	if rule.Disabled {
+		s3Rule.Status = aws.String(s3.ReplicationRuleStatusDisabled)
+	}
+	if rule.DeleteMarkerReplication {
+		s3Rule.DeleteMarkerReplication.Status = aws.String(s3.DeleteMarkerReplicationStatusEnabled)
+	}
+	if rule.StorageClass != "" {
+		s3Rule.Destination.StorageClass = aws.String(rule.StorageClass)
+	}
+	return s3Rule
+}
+
+// fromS3ReplicationRule converts an S3 replication rule to its comparable form
+func fromS3ReplicationRule(s3Rule *s3.ReplicationRule) replicationRule {
+	rule := replicationRule{
+		ID:       aws.StringValue(s3Rule.ID),
+		Priority: aws.Int64Value(s3Rule.Priority),
+		Disabled: aws.StringValue(s3Rule.Status) == s3.ReplicationRuleStatusDisabled,
+		Prefix:   aws.StringValue(s3Rule.Prefix),
+	}
+	if filter := s3Rule.Filter; filter != nil {
+		if filter.And != nil {
+			rule.Prefix = aws.StringValue(filter.And.Prefix)
+		} else {
+			rule.Prefix = aws.StringValue(filter.Prefix)
+		}
+	}
+	if s3Rule.DeleteMarkerReplication != nil {
+		rule.DeleteMarkerReplication = aws.StringValue(s3Rule.DeleteMarkerReplication.Status) == s3.DeleteMarkerReplicationStatusEnabled
+	}
+	if destination := s3Rule.Destination; destination != nil {
+		rule.Destination = strings.TrimPrefix(aws.StringValue(destination.Bucket), bucketARN(""))
+		rule.StorageClass = aws.StringValue(destination.StorageClass)
+	}
+	return rule
+}
+
+// getBucketReplication retrieves the replication role and rules of the S3 bucket, sorted by ID
+func getBucketReplication(svc *s3.S3, bucketName string) (string, []replicationRule, error) {
+	result, err := svc.GetBucketReplication(&s3.GetBucketReplicationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoReplicationConfiguration {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	config := result.ReplicationConfiguration
+	if config == nil {
+		return "", nil, nil
+	}
+	rules := []replicationRule{}
+	for _, s3Rule := range config.Rules {
+		rules = append(rules, fromS3ReplicationRule(s3Rule))
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return aws.StringValue(config.Role), rules, nil
+}
+
+// checkSameAccount rejects replication destinations in another AWS account than the source bucket. The destination bucket
+// policy would have to grant the replication role and the objects would have to change owner, neither is managed.
+func checkSameAccount(clients *s3config.Clients, destinationClients *s3config.Clients, destination *bucketv1.S3Bucket) error {
+	if clients == destinationClients {
+		return nil
+	}
+	account, err := clients.CallerAccount()
+	if err != nil {
+		return err
+	}
+	destinationAccount, err := destinationClients.CallerAccount()
+	if err != nil {
+		return err
+	}
+	if account != destinationAccount {
+		return &reasonError{reason: ReasonCrossAccount, err: fmt.Errorf(
+			"replication destination S3Bucket %s is in AWS account %s, replication to other accounts is not supported",
+			destination.Name, destinationAccount)}
+	}
+	return nil
+}
+
+// removeReplication deletes the replication configuration the operator applied and the replication role it created
+func removeReplication(clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	_, err := clients.S3.DeleteBucketReplication(&s3.DeleteBucketReplicationInput{
+		Bucket: aws.String(s3Bucket.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete bucket replication: %w", err)
+	}
+	if isReplicationRoleManaged(s3Bucket) {
+		if err := deleteReplicationRole(clients.IAM, s3Bucket.Name); err != nil {
+			return fmt.Errorf("failed to delete replication role: %w", err)
+		}
+	}
+	s3Bucket.Status.ReplicationRoleARN = ""
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' replication deleted\n", s3Bucket.Name)))
+	return nil
+}
+
+// reconcileReplication replicates the S3 bucket to the destination S3Buckets once they are online.
+// Versioning is enabled at both ends and the replication role is created unless the spec references one.
+// Once the replication is removed from the spec, the configuration and the role the operator applied are removed too.
+func reconcileReplication(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	replication := s3Bucket.Spec.Replication
+	if replication == nil {
+		// The replication role is recorded once the operator applied the replication
+		if s3Bucket.Status.ReplicationRoleARN == "" {
+			return nil
+		}
+		return removeReplication(clients, s3Bucket)
+	}
+
+	desired := []replicationRule{}
+	destinations := []string{}
+	for i, rule := range replication.Rules {
+		destination, err := r.resolveOnlineBucket(ctx, s3Bucket.Namespace, rule.DestinationRef, "replication destination")
+		if err != nil {
+			return err
+		}
+		destinationClients, err := r.bucketClients(ctx, destination)
+		if err != nil {
+			return err
+		}
+		if err := checkSameAccount(clients, destinationClients, destination); err != nil {
+			return err
+		}
+		if err := ensureDestinationVersioning(destinationClients.S3, destination); err != nil {
+			return fmt.Errorf("failed to enable versioning on replication destination: %w", err)
+		}
+		priority := rule.Priority
+		if priority == 0 {
+			priority = int64(len(replication.Rules) - i)
+		}
+		desired = append(desired, replicationRule{
+			ID:                      rule.ID,
+			Priority:                priority,
+			Disabled:                rule.Disabled,
+			Prefix:                  rule.Prefix,
+			DeleteMarkerReplication: rule.DeleteMarkerReplication,
+			Destination:             destination.Name,
+			StorageClass:            rule.StorageClass,
+		})
+		destinations = append(destinations, destination.Name)
+	}
+	sort.Slice(desired, func(i, j int) bool { return desired[i].ID < desired[j].ID })
+
+	roleARN := replication.RoleARN
+	if roleARN == "" {
+		var err error
+		roleARN, err = ensureReplicationRole(clients.IAM, s3Bucket.Name, destinations)
+		if err != nil {
+			return fmt.Errorf("failed to ensure replication role: %w", err)
+		}
+	}
+	s3Bucket.Status.ReplicationRoleARN = roleARN
+
+	observedRole, observed, err := getBucketReplication(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket replication: %w", err)
+	}
+	if observedRole == roleARN && equality.Semantic.DeepEqual(desired, observed) {
+		return nil
+	}
+
+	s3Rules := []*s3.ReplicationRule{}
+	for _, rule := range desired {
+		s3Rules = append(s3Rules, toS3ReplicationRule(rule))
+	}
+	_, err = svc.PutBucketReplication(&s3.PutBucketReplicationInput{
+		Bucket: aws.String(s3Bucket.Name),
+		ReplicationConfiguration: &s3.ReplicationConfiguration{
+			Role:  aws.String(roleARN),
+			Rules: s3Rules,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket replication: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' replication updated with %d rules\n", s3Bucket.Name, len(s3Rules))))
+	return nil
+}
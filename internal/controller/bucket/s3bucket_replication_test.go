@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+var _ = Describe("S3Bucket replication", func() {
+	DescribeTable("comparing resolved rules with the rules S3 returns",
+		func(rule replicationRule) {
+			Expect(fromS3ReplicationRule(toS3ReplicationRule(rule))).To(Equal(rule))
+		},
+		Entry("defaults", replicationRule{ID: "all", Priority: 1, Destination: "backup"}),
+		Entry("every field", replicationRule{
+			ID:                      "logs",
+			Priority:                2,
+			Disabled:                true,
+			Prefix:                  "logs/",
+			DeleteMarkerReplication: true,
+			Destination:             "backup",
+			StorageClass:            s3.StorageClassStandardIa,
+		}),
+	)
+
+	DescribeTable("reading rules written by other clients",
+		func(s3Rule *s3.ReplicationRule, want replicationRule) {
+			Expect(fromS3ReplicationRule(s3Rule)).To(Equal(want))
+		},
+		Entry("legacy prefix", &s3.ReplicationRule{
+			ID:          aws.String("legacy"),
+			Status:      aws.String(s3.ReplicationRuleStatusEnabled),
+			Prefix:      aws.String("old/"),
+			Destination: &s3.Destination{Bucket: aws.String("arn:aws:s3:::backup")},
+		}, replicationRule{ID: "legacy", Prefix: "old/", Destination: "backup"}),
+		Entry("and filter", &s3.ReplicationRule{
+			ID:       aws.String("tagged"),
+			Priority: aws.Int64(3),
+			Status:   aws.String(s3.ReplicationRuleStatusEnabled),
+			Filter: &s3.ReplicationRuleFilter{And: &s3.ReplicationRuleAndOperator{
+				Prefix: aws.String("data/"),
+				Tags:   []*s3.Tag{{Key: aws.String("a"), Value: aws.String("1")}},
+			}},
+			Destination: &s3.Destination{Bucket: aws.String("arn:aws:s3:::backup")},
+		}, replicationRule{ID: "tagged", Priority: 3, Prefix: "data/", Destination: "backup"}),
+	)
+
+	Context("removing the replication from the spec", func() {
+		var s3 *fakeS3
+
+		BeforeEach(func() {
+			s3 = newFakeS3()
+			s3.addBucket("removed-replication", 0)
+			s3.setReplication("removed-replication")
+		})
+
+		AfterEach(func() {
+			s3.close()
+		})
+
+		DescribeTable("deleting the replication the operator applied",
+			func(roleARN string, wantIAMCalls []string) {
+				s3Bucket := &bucketv1.S3Bucket{
+					ObjectMeta: metav1.ObjectMeta{Name: "removed-replication"},
+					Status:     bucketv1.S3BucketStatus{ReplicationRoleARN: roleARN},
+				}
+				Expect(reconcileReplication(nil, context.Background(), s3.clients(), s3Bucket)).To(Succeed())
+				Expect(s3.hasReplication("removed-replication")).To(BeFalse())
+				Expect(s3.recordedIAMCalls()).To(Equal(wantIAMCalls))
+				Expect(s3Bucket.Status.ReplicationRoleARN).To(BeEmpty())
+			},
+			Entry("with the managed role", "arn:aws:iam::123456789012:role/"+replicationRoleName("removed-replication"),
+				[]string{"DeleteRolePolicy", "DeleteRole"}),
+			Entry("with a role of the spec", "arn:aws:iam::123456789012:role/replication", []string{}),
+		)
+
+		It("leaves replication the operator didn't apply alone", func() {
+			s3Bucket := &bucketv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "removed-replication"}}
+			Expect(reconcileReplication(nil, context.Background(), s3.clients(), s3Bucket)).To(Succeed())
+			Expect(s3.hasReplication("removed-replication")).To(BeTrue())
+		})
+	})
+
+	It("rejects destinations in another AWS account", func() {
+		source, destination := newFakeS3(), newFakeS3()
+		defer source.close()
+		defer destination.close()
+		destination.account = "210987654321"
+		destinationBucket := &bucketv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{Name: "backup"}}
+
+		err := checkSameAccount(source.clients(), destination.clients(), destinationBucket)
+		Expect(errorReason(err, ReasonReconcileError)).To(Equal(ReasonCrossAccount))
+		Expect(checkSameAccount(source.clients(), source.clients(), destinationBucket)).To(Succeed())
+	})
+
+	It("keeps replication role names within the IAM limit", func() {
+		Expect(len(replicationRoleName("a-very-long-bucket-name-that-uses-all-of-the-sixty-three-chars"))).To(BeNumerically("<=", 64))
+	})
+})
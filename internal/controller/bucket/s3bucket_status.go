@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+// Reasons for the conditions of S3Bucket
+const (
+	ReasonAvailable           = "Available"
+	ReasonCreating            = "Creating"
+	ReasonOffline             = "Offline"
+	ReasonBucketNotFound      = "BucketNotFound"
+	ReasonReconcileSuccess    = "ReconcileSuccess"
+	ReasonReconcileError      = "ReconcileError"
+	ReasonDeleting            = "Deleting"
+	ReasonDeleteError         = "DeleteError"
+	ReasonHealthy             = "Healthy"
+	ReasonTargetNotFound      = "TargetNotFound"
+	ReasonTargetNotOnline     = "TargetNotOnline"
+	ReasonResolved            = "Resolved"
+	ReasonObjectLockImmutable = "ObjectLockImmutable"
+	ReasonProviderConfigError = "ProviderConfigError"
+	ReasonRegionMismatch      = "RegionMismatch"
+	ReasonBucketExists        = "BucketExists"
+	ReasonCrossAccount        = "CrossAccount"
+)
+
+var conditionReasonRegexp = regexp.MustCompile(`^[A-Za-z]([A-Za-z0-9_,:]*[A-Za-z0-9_])?$`)
+
+// reasonError is an error reported with its own condition reason
+type reasonError struct {
+	reason string
+	err    error
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+// errorReason returns the reason of a reasonError or the AWS error code of the error (e.g. AccessDenied) as condition reason,
+// or fallback otherwise
+func errorReason(err error, fallback string) string {
+	var rerr *reasonError
+	if errors.As(err, &rerr) {
+		return rerr.reason
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && conditionReasonRegexp.MatchString(aerr.Code()) {
+		return aerr.Code()
+	}
+	return fallback
+}
+
+// setCondition sets the condition on the status of the S3Bucket for its current generation
+func setCondition(s3Bucket *bucketv1.S3Bucket, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&s3Bucket.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: s3Bucket.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setSyncError records the error of the last reconcile in the Synced condition and status.Message
+func setSyncError(s3Bucket *bucketv1.S3Bucket, err error, fallbackReason string) {
+	s3Bucket.Status.Message = err.Error()
+	setCondition(s3Bucket, bucketv1.ConditionSynced, metav1.ConditionFalse, errorReason(err, fallbackReason), err.Error())
+}
+
+// setSynced records that the last reconcile succeeded
+func setSynced(s3Bucket *bucketv1.S3Bucket) {
+	s3Bucket.Status.Message = ""
+	s3Bucket.Status.ObservedGeneration = s3Bucket.Generation
+	setCondition(s3Bucket, bucketv1.ConditionSynced, metav1.ConditionTrue, ReasonReconcileSuccess, "")
+}
+
+// updateStatus writes the status of the S3Bucket if it differs from the original status
+func (r *S3BucketReconciler) updateStatus(ctx context.Context, s3Bucket *bucketv1.S3Bucket, original *bucketv1.S3BucketStatus) error {
+	if equality.Semantic.DeepEqual(original, &s3Bucket.Status) {
+		return nil
+	}
+	return r.Status().Update(ctx, s3Bucket)
+}
+
+// updateKeepingStatus writes the metadata and spec of the S3Bucket without losing the pending changes to its status
+func (r *S3BucketReconciler) updateKeepingStatus(ctx context.Context, s3Bucket *bucketv1.S3Bucket) error {
+	status := s3Bucket.Status.DeepCopy()
+	if err := r.Update(ctx, s3Bucket); err != nil {
+		return err
+	}
+	s3Bucket.Status = *status
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoSuchTagSet is returned by GetBucketTagging for buckets without tags
+const errCodeNoSuchTagSet = "NoSuchTagSet"
+
+// reservedTags returns the tags the operator applies to the S3 bucket of the S3Bucket
+func (r *S3BucketReconciler) reservedTags(s3Bucket *bucketv1.S3Bucket) map[string]string {
+	tags := map[string]string{
+		bucketv1.TagNamespace: s3Bucket.Namespace,
+		bucketv1.TagName:      s3Bucket.Name,
+	}
+	if groupName := s3Bucket.Labels[bucketgroupv1.BucketGroupNameLabel]; groupName != "" {
+		tags[bucketv1.TagBucketGroup] = groupName
+	}
+	if r.ClusterID != "" {
+		tags[bucketv1.TagClusterID] = r.ClusterID
+	}
+	return tags
+}
+
+// desiredTags merges the tags of the S3Bucket spec with the reserved tags, which always win.
+// Returns the keys of the spec tags that were ignored because they are reserved.
+func (r *S3BucketReconciler) desiredTags(s3Bucket *bucketv1.S3Bucket) (map[string]string, []string) {
+	tags := r.reservedTags(s3Bucket)
+	ignored := []string{}
+	for key, value := range s3Bucket.Spec.Tags {
+		if strings.HasPrefix(key, bucketv1.GroupVersion.Group+"/") {
+			ignored = append(ignored, key)
+			continue
+		}
+		tags[key] = value
+	}
+	sort.Strings(ignored)
+	return tags, ignored
+}
+
+// getBucketTags retrieves the tags of the S3 bucket
+func getBucketTags(svc *s3.S3, bucketName string) (map[string]string, error) {
+	result, err := svc.GetBucketTagging(&s3.GetBucketTaggingInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoSuchTagSet {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	return fromS3Tags(result.TagSet), nil
+}
+
+// reconcileTags applies the spec tags and the reserved tags to the S3 bucket, removing any other tag
+func reconcileTags(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	desired, ignored := r.desiredTags(s3Bucket)
+	observed, err := getBucketTags(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket tags: %w", err)
+	}
+	if equality.Semantic.DeepEqual(desired, observed) {
+		return nil
+	}
+
+	if len(ignored) > 0 {
+		r.Recorder.Eventf(s3Bucket, corev1.EventTypeWarning, "ReservedTagsIgnored",
+			"Tags %s are reserved by the operator and were ignored", strings.Join(ignored, ", "))
+	}
+	_, err = svc.PutBucketTagging(&s3.PutBucketTaggingInput{
+		Bucket:  aws.String(s3Bucket.Name),
+		Tagging: &s3.Tagging{TagSet: toS3Tags(desired)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket tags: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' tags updated\n", s3Bucket.Name)))
+	return nil
+}
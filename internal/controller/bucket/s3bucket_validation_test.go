@@ -0,0 +1,58 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+var _ = Describe("S3Bucket validation", func() {
+	DescribeTable("rejecting changes of immutable fields",
+		func(name string, spec bucketv1.S3BucketSpec, change func(*bucketv1.S3BucketSpec), message string) {
+			ctx := context.Background()
+			s3Bucket := &bucketv1.S3Bucket{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec:       spec,
+			}
+			Expect(k8sClient.Create(ctx, s3Bucket)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, s3Bucket)).To(Succeed())
+			})
+
+			change(&s3Bucket.Spec)
+			err := k8sClient.Update(ctx, s3Bucket)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(message))
+		},
+		Entry("changing the region", "immutable-region-changed",
+			bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline, Region: "eu-central-1"},
+			func(spec *bucketv1.S3BucketSpec) { spec.Region = "us-east-1" }, "region is immutable"),
+		Entry("setting the region", "immutable-region-set",
+			bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline},
+			func(spec *bucketv1.S3BucketSpec) { spec.Region = "us-east-1" }, "region is immutable"),
+		Entry("changing the provider", "immutable-provider",
+			bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline, ProviderConfigRef: "a"},
+			func(spec *bucketv1.S3BucketSpec) { spec.ProviderConfigRef = "b" }, "providerConfigRef is immutable"),
+	)
+})
@@ -0,0 +1,75 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// desiredVersioning returns the versioning state the S3 bucket needs, replication requires versioning
+func desiredVersioning(s3Bucket *bucketv1.S3Bucket) bucketv1.VersioningState {
+	if s3Bucket.Spec.Replication != nil {
+		return bucketv1.VersioningEnabled
+	}
+	return s3Bucket.Spec.Versioning
+}
+
+// reconcileVersioning applies the desired versioning state to the S3 bucket.
+// Versioning changed outside of the operator is reverted and reported in an event.
+func reconcileVersioning(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	result, err := svc.GetBucketVersioning(&s3.GetBucketVersioningInput{
+		Bucket: aws.String(s3Bucket.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get bucket versioning: %w", err)
+	}
+	observed := bucketv1.VersioningState(aws.StringValue(result.Status))
+	desired := desiredVersioning(s3Bucket)
+	if desired == "" || observed == desired {
+		s3Bucket.Status.Versioning = observed
+		return nil
+	}
+
+	// The versioning state was applied before, so someone else changed it
+	if s3Bucket.Status.Versioning == desired {
+		r.Recorder.Eventf(s3Bucket, corev1.EventTypeWarning, "VersioningDrift",
+			"Bucket versioning was changed to %q outside of the operator, reverting to %q", observed, desired)
+	}
+
+	_, err = svc.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket: aws.String(s3Bucket.Name),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(string(desired)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket versioning: %w", err)
+	}
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' versioning set to %s\n", s3Bucket.Name, desired)))
+	s3Bucket.Status.Versioning = desired
+	return nil
+}
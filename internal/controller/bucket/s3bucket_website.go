@@ -0,0 +1,212 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+// errCodeNoSuchWebsiteConfiguration is returned by GetBucketWebsite for buckets without website hosting
+const errCodeNoSuchWebsiteConfiguration = "NoSuchWebsiteConfiguration"
+
+// dashWebsiteRegions are the regions whose website endpoints use s3-website-<region> instead of s3-website.<region>
+var dashWebsiteRegions = map[string]bool{
+	"us-east-1":      true,
+	"us-west-1":      true,
+	"us-west-2":      true,
+	"ap-southeast-1": true,
+	"ap-southeast-2": true,
+	"ap-northeast-1": true,
+	"eu-west-1":      true,
+	"sa-east-1":      true,
+	"us-gov-west-1":  true,
+}
+
+// awsDNSSuffixes are the domains of the AWS S3 endpoints, their website endpoints live in the same domain
+var awsDNSSuffixes = []string{"amazonaws.com", "amazonaws.com.cn"}
+
+// websiteEndpoint returns the website endpoint of the S3 bucket in the region, derived from the S3 endpoint of the client.
+// It is empty for S3 compatible stores, they have no standard website endpoint.
+func websiteEndpoint(bucketName string, region string, s3Endpoint string) string {
+	endpoint, err := url.Parse(s3Endpoint)
+	if err != nil {
+		return ""
+	}
+	dnsSuffix := ""
+	for _, suffix := range awsDNSSuffixes {
+		if strings.HasSuffix(endpoint.Hostname(), "."+suffix) {
+			dnsSuffix = suffix
+		}
+	}
+	if dnsSuffix == "" {
+		return ""
+	}
+	if dashWebsiteRegions[region] {
+		return fmt.Sprintf("http://%s.s3-website-%s.%s", bucketName, region, dnsSuffix)
+	}
+	return fmt.Sprintf("http://%s.s3-website.%s.%s", bucketName, region, dnsSuffix)
+}
+
+// optionalString returns nil for empty strings, S3 rejects some empty website settings
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+// toS3Website converts the website block of the S3Bucket spec to an S3 website configuration
+func toS3Website(website *bucketv1.BucketWebsite) *s3.WebsiteConfiguration {
+	config := &s3.WebsiteConfiguration{}
+	if website.IndexDocument != "" {
+		config.IndexDocument = &s3.IndexDocument{Suffix: aws.String(website.IndexDocument)}
+	}
+	if website.ErrorDocument != "" {
+		config.ErrorDocument = &s3.ErrorDocument{Key: aws.String(website.ErrorDocument)}
+	}
+	if redirect := website.RedirectAllRequestsTo; redirect != nil {
+		config.RedirectAllRequestsTo = &s3.RedirectAllRequestsTo{
+			HostName: aws.String(redirect.HostName),
+			Protocol: optionalString(redirect.Protocol),
+		}
+	}
+	for _, rule := range website.RoutingRules {
+		s3Rule := &s3.RoutingRule{
+			Redirect: &s3.Redirect{
+				HostName:             optionalString(rule.Redirect.HostName),
+				Protocol:             optionalString(rule.Redirect.Protocol),
+				HttpRedirectCode:     optionalString(rule.Redirect.HTTPRedirectCode),
+				ReplaceKeyPrefixWith: optionalString(rule.Redirect.ReplaceKeyPrefixWith),
+				ReplaceKeyWith:       optionalString(rule.Redirect.ReplaceKeyWith),
+			},
+		}
+		if rule.Condition != nil {
+			s3Rule.Condition = &s3.Condition{
+				KeyPrefixEquals:             optionalString(rule.Condition.KeyPrefixEquals),
+				HttpErrorCodeReturnedEquals: optionalString(rule.Condition.HTTPErrorCodeReturnedEquals),
+			}
+		}
+		config.RoutingRules = append(config.RoutingRules, s3Rule)
+	}
+	return config
+}
+
+// fromS3Website converts an S3 website configuration to the form of the S3Bucket spec, so both can be compared
+func fromS3Website(result *s3.GetBucketWebsiteOutput) *bucketv1.BucketWebsite {
+	website := &bucketv1.BucketWebsite{}
+	if result.IndexDocument != nil {
+		website.IndexDocument = aws.StringValue(result.IndexDocument.Suffix)
+	}
+	if result.ErrorDocument != nil {
+		website.ErrorDocument = aws.StringValue(result.ErrorDocument.Key)
+	}
+	if redirect := result.RedirectAllRequestsTo; redirect != nil {
+		website.RedirectAllRequestsTo = &bucketv1.WebsiteRedirect{
+			HostName: aws.StringValue(redirect.HostName),
+			Protocol: aws.StringValue(redirect.Protocol),
+		}
+	}
+	for _, s3Rule := range result.RoutingRules {
+		rule := bucketv1.WebsiteRoutingRule{}
+		if redirect := s3Rule.Redirect; redirect != nil {
+			rule.Redirect = bucketv1.RoutingRuleRedirect{
+				HostName:             aws.StringValue(redirect.HostName),
+				Protocol:             aws.StringValue(redirect.Protocol),
+				HTTPRedirectCode:     aws.StringValue(redirect.HttpRedirectCode),
+				ReplaceKeyPrefixWith: aws.StringValue(redirect.ReplaceKeyPrefixWith),
+				ReplaceKeyWith:       aws.StringValue(redirect.ReplaceKeyWith),
+			}
+		}
+		if condition := s3Rule.Condition; condition != nil {
+			rule.Condition = &bucketv1.RoutingRuleCondition{
+				KeyPrefixEquals:             aws.StringValue(condition.KeyPrefixEquals),
+				HTTPErrorCodeReturnedEquals: aws.StringValue(condition.HttpErrorCodeReturnedEquals),
+			}
+		}
+		website.RoutingRules = append(website.RoutingRules, rule)
+	}
+	return website
+}
+
+// getBucketWebsite retrieves the website configuration of the S3 bucket, nil if website hosting is disabled
+func getBucketWebsite(svc *s3.S3, bucketName string) (*bucketv1.BucketWebsite, error) {
+	result, err := svc.GetBucketWebsite(&s3.GetBucketWebsiteInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == errCodeNoSuchWebsiteConfiguration {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return fromS3Website(result), nil
+}
+
+// reconcileWebsite applies the desired website configuration to the S3 bucket and records its website endpoint.
+// Website hosting is disabled when the S3Bucket has no website block.
+func reconcileWebsite(r *S3BucketReconciler, ctx context.Context, clients *s3config.Clients, s3Bucket *bucketv1.S3Bucket) error {
+	svc := clients.S3
+	desired := s3Bucket.Spec.Website
+	observed, err := getBucketWebsite(svc, s3Bucket.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket website configuration: %w", err)
+	}
+	if equality.Semantic.DeepEqual(desired, observed) {
+		s3Bucket.Status.WebsiteEndpoint = ""
+		if desired != nil {
+			s3Bucket.Status.WebsiteEndpoint = websiteEndpoint(s3Bucket.Name, aws.StringValue(svc.Config.Region), svc.Endpoint)
+		}
+		return nil
+	}
+
+	if desired == nil {
+		_, err = svc.DeleteBucketWebsite(&s3.DeleteBucketWebsiteInput{
+			Bucket: aws.String(s3Bucket.Name),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete bucket website configuration: %w", err)
+		}
+		s3Bucket.Status.WebsiteEndpoint = ""
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' website hosting disabled\n", s3Bucket.Name)))
+		return nil
+	}
+
+	_, err = svc.PutBucketWebsite(&s3.PutBucketWebsiteInput{
+		Bucket:               aws.String(s3Bucket.Name),
+		WebsiteConfiguration: toS3Website(desired),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket website configuration: %w", err)
+	}
+	s3Bucket.Status.WebsiteEndpoint = websiteEndpoint(s3Bucket.Name, aws.StringValue(svc.Config.Region), svc.Endpoint)
+	log.Log.Info(colorCodeMessage(fmt.Sprintf("S3 bucket '%s' website hosting enabled\n", s3Bucket.Name)))
+	return nil
+}
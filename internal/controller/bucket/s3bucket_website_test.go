@@ -0,0 +1,35 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bucket
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("S3Bucket website", func() {
+	DescribeTable("deriving the website endpoint",
+		func(region, s3Endpoint, want string) {
+			Expect(websiteEndpoint("b", region, s3Endpoint)).To(Equal(want))
+		},
+		Entry("dash region", "us-west-1", "https://s3.us-west-1.amazonaws.com", "http://b.s3-website-us-west-1.amazonaws.com"),
+		Entry("dot region", "eu-central-1", "https://s3.eu-central-1.amazonaws.com", "http://b.s3-website.eu-central-1.amazonaws.com"),
+		Entry("china region", "cn-north-1", "https://s3.cn-north-1.amazonaws.com.cn", "http://b.s3-website.cn-north-1.amazonaws.com.cn"),
+		Entry("localstack", "us-west-1", "http://localhost:4566", ""),
+		Entry("s3 compatible store", "us-east-1", "https://minio.example.com", ""),
+	)
+})
@@ -19,11 +19,11 @@ package controller
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -36,16 +36,18 @@ import (
 
 	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
 	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+	"art-of-infrastructure-management/internal/s3config"
 )
 
-var bucket_id = 1
 var DefaultRequeueInterval = time.Second * 10
 
 // S3BucketGroupReconciler reconciles a S3BucketGroup object
 type S3BucketGroupReconciler struct {
 	client.Client
-	Scheme   *runtime.Scheme
-	S3Client *s3.S3
+	Scheme *runtime.Scheme
+
+	// Clients hands out the AWS clients of the S3ProviderConfig of each S3BucketGroup
+	Clients *s3config.ClientCache
 }
 
 func colorCodeMessage(message string) string {
@@ -57,6 +59,8 @@ func colorCodeMessage(message string) string {
 //+kubebuilder:rbac:groups=bucketgroup.my.domain,resources=s3bucketgroups,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=bucketgroup.my.domain,resources=s3bucketgroups/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=bucketgroup.my.domain,resources=s3bucketgroups/finalizers,verbs=update
+//+kubebuilder:rbac:groups=bucket.my.domain,resources=s3buckets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=bucket.my.domain,resources=s3providerconfigs,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -71,17 +75,17 @@ func (r *S3BucketGroupReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	_ = log.FromContext(ctx)
 
 	// Uncomment to run part 2
-	result, err := DoPart2(r, ctx, req)
-	if err != nil {
-		log.Log.Error(err, colorCodeMessage("error occurred when running part 2"))
-	}
-
-	// Uncomment to run part 3
-	// result, err := DoPart3(r, ctx, req)
+	// result, err := DoPart2(r, ctx, req)
 	// if err != nil {
-	// 	log.Log.Error(err, colorCodeMessage("error occurred when running part 3"))
+	// 	log.Log.Error(err, colorCodeMessage("error occurred when running part 2"))
 	// }
 
+	// Uncomment to run part 3
+	result, err := DoPart3(r, ctx, req)
+	if err != nil {
+		log.Log.Error(err, colorCodeMessage("error occurred when running part 3"))
+	}
+
 	return result, nil
 }
 
@@ -98,16 +102,9 @@ func createS3Bucket(svc *s3.S3, bucketName string) error {
 	return nil
 }
 
-// generateNewBucketName creates the new bucket name based on the current bucket_id
-func generateNewBucketName() string {
-	bucketName := "my-s3-bucket-" + strconv.Itoa(bucket_id)
-	bucket_id += 1
-	return bucketName
-}
-
 // GetBuckets retrieves the current number of S3 bucets in the S3BucketGroup
-func (r *S3BucketGroupReconciler) GetBuckets() (*s3.ListBucketsOutput, error) {
-	buckets, err := r.S3Client.ListBuckets(&s3.ListBucketsInput{})
+func (r *S3BucketGroupReconciler) GetBuckets(svc *s3.S3) (*s3.ListBucketsOutput, error) {
+	buckets, err := svc.ListBuckets(&s3.ListBucketsInput{})
 	if err != nil {
 		log.Log.Error(err, colorCodeMessage("error listing S3 buckets"))
 		return nil, err
@@ -117,18 +114,25 @@ func (r *S3BucketGroupReconciler) GetBuckets() (*s3.ListBucketsOutput, error) {
 
 // DoPart2 holds the logic to demonstrate the demo for Part 2
 func DoPart2(r *S3BucketGroupReconciler, ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	// Retrieves the current number of buckets
-	result, err := r.GetBuckets()
+	// Retrieve the current state of the S3BucketGroup
+	s3BucketGroup := &bucketgroupv1.S3BucketGroup{}
+	err := r.Get(context.TODO(), req.NamespacedName, s3BucketGroup)
 	if err != nil {
-		log.Log.Error(err, colorCodeMessage("error while retrieving s3 buckets"))
+		log.Log.Error(err, colorCodeMessage("failed to retrieve current state of bucket group"))
 		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 	}
 
-	// Retrieve the current state of the S3BucketGroup
-	s3BucketGroup := &bucketgroupv1.S3BucketGroup{}
-	err = r.Get(context.TODO(), req.NamespacedName, s3BucketGroup)
+	// The buckets of the group live behind the S3ProviderConfig of the group
+	clients, err := r.Clients.ForProvider(ctx, s3BucketGroup.Spec.ProviderConfigRef)
 	if err != nil {
-		log.Log.Error(err, colorCodeMessage("failed to retrieve current state of bucket group"))
+		log.Log.Error(err, colorCodeMessage("failed to get the AWS clients of the bucket group"))
+		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+	}
+
+	// Retrieves the current number of buckets
+	result, err := r.GetBuckets(clients.S3)
+	if err != nil {
+		log.Log.Error(err, colorCodeMessage("error while retrieving s3 buckets"))
 		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 	}
 
@@ -149,25 +153,40 @@ func DoPart2(r *S3BucketGroupReconciler, ctx context.Context, req ctrl.Request)
 	)
 
 	// Create new S3 buckets if the current S3BucketGroup count < desired S3BucketGroup count
+	var syncErr error
 	if s3BucketGroup.Status.BucketCount < s3BucketGroup.Spec.DesiredBucketCount {
 		deficit := s3BucketGroup.Spec.DesiredBucketCount - len(result.Buckets)
 		for i := 0; i < deficit; i++ {
-			bucketName := generateNewBucketName()
-			err := createS3Bucket(r.S3Client, bucketName)
+			bucketName, err := generateNewBucketName(r, ctx, s3BucketGroup)
+			if err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to generate s3 bucket name"))
+				syncErr = err
+				break
+			}
+			err = createS3Bucket(clients.S3, bucketName)
 			if err != nil {
 				log.Log.Error(err, colorCodeMessage("failed to create s3 bucket"))
+				syncErr = err
 			} else {
 				s3BucketGroup.Status.BucketCount += 1
 			}
 			// Add sleep for easier traceability
 			time.Sleep(time.Second * 10)
 		}
-		if err := r.Status().Update(ctx, s3BucketGroup); err != nil {
-			log.Log.Error(err, colorCodeMessage("failed to update s3BucketGroup status"))
-		}
 	} else {
 		log.Log.Info(colorCodeMessage("No creations needed. Desired S3 bucket count == Current S3 bucket count"))
 	}
+
+	setGroupSynced(s3BucketGroup, syncErr)
+	if s3BucketGroup.Status.BucketCount < s3BucketGroup.Spec.DesiredBucketCount {
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionReady, metav1.ConditionFalse, ReasonScalingUp,
+			fmt.Sprintf("%d of %d buckets created", s3BucketGroup.Status.BucketCount, s3BucketGroup.Spec.DesiredBucketCount))
+	} else {
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionReady, metav1.ConditionTrue, ReasonBucketsReady, "")
+	}
+	if err := r.Status().Update(ctx, s3BucketGroup); err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to update s3BucketGroup status"))
+	}
 	return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, nil
 }
 
@@ -176,14 +195,13 @@ func createS3BucketCRD(r *S3BucketGroupReconciler, ctx context.Context, req ctrl
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      bucketName,
 			Namespace: req.Namespace,
-			Labels: map[string]string{
-				"bucketGroupName": bucketGroup.Name,
-			},
-		},
-		Spec: bucketv1.S3BucketSpec{
-			Phase: bucketv1.PhaseOnline,
 		},
 	}
+	applyBucketTemplate(bucket, bucketGroup)
+	// The S3BucketGroup owns its S3Buckets, they are garbage collected with it and wake it up on changes
+	if err := ctrl.SetControllerReference(bucketGroup, bucket, r.Scheme); err != nil {
+		return bucket, err
+	}
 	err := r.Client.Create(ctx, bucket)
 	if err != nil {
 		return bucket, err
@@ -200,7 +218,7 @@ func createS3BucketCRD(r *S3BucketGroupReconciler, ctx context.Context, req ctrl
 func listBucketsInBucketGroup(r *S3BucketGroupReconciler, ctx context.Context, s3BucketGroup *bucketgroupv1.S3BucketGroup) ([]bucketv1.S3Bucket, error) {
 	var buckets bucketv1.S3BucketList
 	selector := labels.NewSelector()
-	bgReq, _ := labels.NewRequirement("bucketGroupName", selection.Equals, []string{s3BucketGroup.Name})
+	bgReq, _ := labels.NewRequirement(bucketgroupv1.BucketGroupNameLabel, selection.Equals, []string{s3BucketGroup.Name})
 	selector = selector.Add(*bgReq)
 
 	listOptions := &client.ListOptions{
@@ -213,10 +231,41 @@ func listBucketsInBucketGroup(r *S3BucketGroupReconciler, ctx context.Context, s
 	return buckets.Items, nil
 }
 
-// clearOfflineBuckets deletes buckets that are completely offline (spec.Phase = "online" && status.Phase = "offline")
+// adoptBuckets sets the S3BucketGroup as controller of the buckets in the group created without an owner reference
+// and annotated with AdoptAnnotation. It returns the buckets controlled by the S3BucketGroup, the others are left alone.
+func adoptBuckets(r *S3BucketGroupReconciler, ctx context.Context, s3BucketGroup *bucketgroupv1.S3BucketGroup, buckets []bucketv1.S3Bucket) ([]bucketv1.S3Bucket, error) {
+	owned := []bucketv1.S3Bucket{}
+	for i := range buckets {
+		if owner := metav1.GetControllerOf(&buckets[i]); owner != nil {
+			if owner.UID == s3BucketGroup.UID {
+				owned = append(owned, buckets[i])
+			}
+			continue
+		}
+		if buckets[i].Annotations[bucketgroupv1.AdoptAnnotation] != "true" {
+			log.Log.Info(colorCodeMessage(fmt.Sprintf("Skipping bucket %s, it is not annotated with %s=true", buckets[i].Name, bucketgroupv1.AdoptAnnotation)))
+			continue
+		}
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("Adopting bucket %s", buckets[i].Name)))
+		if err := ctrl.SetControllerReference(s3BucketGroup, &buckets[i], r.Scheme); err != nil {
+			return owned, err
+		}
+		if err := r.Client.Update(ctx, &buckets[i]); err != nil {
+			return owned, err
+		}
+		owned = append(owned, buckets[i])
+	}
+	return owned, nil
+}
+
+// clearOfflineBuckets deletes buckets that are completely offline (spec.Phase = "online" && status.Phase = "offline").
+// Buckets taken offline on purpose and being brought back online are kept.
 func clearOfflineBuckets(r *S3BucketGroupReconciler, ctx context.Context, buckets []bucketv1.S3Bucket) (bool, error) {
 	isBucketsCleared := false
 	for _, bucket := range buckets {
+		if _, isTakenOffline := bucket.Annotations[bucketv1.PreOfflinePolicyAnnotation]; isTakenOffline {
+			continue
+		}
 		if bucket.Spec.Phase == bucketv1.PhaseOnline && bucket.Status.Phase == bucketv1.PhaseOffline {
 			log.Log.Info(colorCodeMessage(fmt.Sprintf("Deleting bucket %s", bucket.Name)))
 			if err := r.Client.Delete(ctx, &bucket); err != nil {
@@ -234,6 +283,11 @@ func DoPart3(r *S3BucketGroupReconciler, ctx context.Context, req ctrl.Request)
 	s3BucketGroup := &bucketgroupv1.S3BucketGroup{}
 	err := r.Get(context.TODO(), req.NamespacedName, s3BucketGroup)
 	if err != nil {
+		// Owned S3Buckets being garbage collected still wake up the deleted S3BucketGroup
+		if errors.IsNotFound(err) {
+			log.Log.Info(colorCodeMessage("Bucket group was deleted...skipping reconcile"))
+			return ctrl.Result{}, nil
+		}
 		log.Log.Error(err, colorCodeMessage("failed to retrieve current state of s3BucketGroup"))
 		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 	}
@@ -245,6 +299,13 @@ func DoPart3(r *S3BucketGroupReconciler, ctx context.Context, req ctrl.Request)
 		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 	}
 
+	// Take ownership of buckets in the S3BucketGroup created without an owner reference that opted in
+	bucketsInBG, err = adoptBuckets(r, ctx, s3BucketGroup, bucketsInBG)
+	if err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to adopt buckets in bucket group"), "Bucket Group", s3BucketGroup.Name)
+		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+	}
+
 	// Clear buckets that are in an unrecoverable state (spec.Phase = "online" && status.Phase = "offline")
 	isBucketsDeleted, err := clearOfflineBuckets(r, ctx, bucketsInBG)
 	// If buckets were cleared, force reconcile to retrieve updated list of buckets
@@ -256,6 +317,9 @@ func DoPart3(r *S3BucketGroupReconciler, ctx context.Context, req ctrl.Request)
 		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
 	}
 
+	// Buckets that are already being deleted no longer count towards the S3BucketGroup
+	bucketsInBG = activeBuckets(bucketsInBG)
+
 	// Update the S3BucketGroup status if the status differs from the actual state.
 	// Force reconcile if status was updated.
 	s3BucketGroup.Status.BucketCount = len(bucketsInBG)
@@ -272,31 +336,60 @@ func DoPart3(r *S3BucketGroupReconciler, ctx context.Context, req ctrl.Request)
 			s3BucketGroup.Status.BucketCount, s3BucketGroup.Spec.DesiredBucketCount)),
 	)
 
+	// syncErr records the last error of this reconcile in the Synced condition
+	var syncErr error
 	if s3BucketGroup.Status.BucketCount < s3BucketGroup.Spec.DesiredBucketCount {
 		deficit := s3BucketGroup.Spec.DesiredBucketCount - len(bucketsInBG)
 		for i := 0; i < deficit; i++ {
-			bucketName := generateNewBucketName()
+			bucketName, err := generateNewBucketName(r, ctx, s3BucketGroup)
+			if err != nil {
+				log.Log.Error(err, colorCodeMessage("failed to generate s3 bucket name"), "Bucket Group", s3BucketGroup.Name)
+				syncErr = err
+				break
+			}
 			_, err = createS3BucketCRD(r, ctx, req, bucketName, s3BucketGroup)
 			if err != nil {
 				log.Log.Error(err, colorCodeMessage("failed to create s3 bucket"), "Bucket Group", s3BucketGroup.Name)
+				syncErr = err
 			}
-			// Add sleep for better traceability
-			time.Sleep(time.Second * 5)
-
+		}
+	} else if s3BucketGroup.Status.BucketCount > s3BucketGroup.Spec.DesiredBucketCount {
+		// Delete surplus S3Buckets if the current S3BucketGroup count > desired S3BucketGroup count.
+		// The deleted buckets are left out of the rollout, they are going away.
+		bucketsInBG, err = scaleDownBuckets(r, ctx, s3BucketGroup, bucketsInBG)
+		if err != nil {
+			log.Log.Error(err, colorCodeMessage("failed to scale down s3 buckets"), "Bucket Group", s3BucketGroup.Name)
+			syncErr = err
 		}
 	} else {
 		log.Log.Info(colorCodeMessage("No creations needed. Desired S3 bucket count == Current S3 bucket count"))
 	}
 
+	// Roll out template changes to the existing S3Buckets
+	if err := rolloutBucketTemplate(r, ctx, s3BucketGroup, bucketsInBG); err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to roll out bucket template"), "Bucket Group", s3BucketGroup.Name)
+		syncErr = err
+	}
+
+	// Persist the conditions and the next ordinal, so names are not reused after a restart
+	setGroupSynced(s3BucketGroup, syncErr)
+	setGroupBucketConditions(s3BucketGroup, bucketsInBG)
+	if err := r.Status().Update(ctx, s3BucketGroup); err != nil {
+		log.Log.Error(err, colorCodeMessage("failed to update s3BucketGroup status"))
+		return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, err
+	}
+
 	return ctrl.Result{RequeueAfter: DefaultRequeueInterval}, nil
 
 }
 
-// ignoreDeletionPredicate prevents the MachineGroupReconciler from listening to deletion events on desired Kinds
+// ignoreDeletionPredicate prevents the S3BucketGroupReconciler from listening to deletion events of S3BucketGroups.
+// Deletion events of owned S3Buckets still wake up their S3BucketGroup so the deleted buckets get replaced.
 func ignoreDeletionPredicate() predicate.Predicate {
 	return predicate.Funcs{
 		DeleteFunc: func(e event.DeleteEvent) bool {
-			return e.Object.GetObjectKind().GroupVersionKind().Kind != "S3Bucket"
+			_, isBucketGroup := e.Object.(*bucketgroupv1.S3BucketGroup)
+			return !isBucketGroup
 		},
 	}
 }
@@ -305,6 +398,7 @@ func ignoreDeletionPredicate() predicate.Predicate {
 func (r *S3BucketGroupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&bucketgroupv1.S3BucketGroup{}).
+		Owns(&bucketv1.S3Bucket{}).
 		WithEventFilter(ignoreDeletionPredicate()).
 		Complete(r)
 }
@@ -0,0 +1,161 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+	"art-of-infrastructure-management/internal/s3config"
+)
+
+var _ = Describe("S3BucketGroup controller", func() {
+	var (
+		ctx    context.Context
+		server *httptest.Server
+		r      *S3BucketGroupReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		// No bucket exists on this S3 endpoint
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		config := s3config.Config{Endpoint: server.URL, Region: "us-east-1", ForcePathStyle: aws.Bool(true)}
+		session, err := config.NewSession(credentials.NewStaticCredentials("test", "test", ""))
+		Expect(err).NotTo(HaveOccurred())
+
+		r = &S3BucketGroupReconciler{
+			Client:  k8sClient,
+			Scheme:  scheme.Scheme,
+			Clients: s3config.NewClientCache(k8sClient, k8sClient, s3config.NewClients(session)),
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("scales the bucket group up and down", func() {
+		group := &bucketgroupv1.S3BucketGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "scaling", Namespace: "default"},
+			Spec: bucketgroupv1.S3BucketGroupSpec{
+				DesiredBucketCount: 2,
+				DeletionPolicy:     bucketv1.DeletionPolicyRetain,
+				Template: bucketgroupv1.S3BucketTemplate{
+					Metadata: bucketgroupv1.S3BucketTemplateMeta{Labels: map[string]string{"team": "storage"}},
+					Spec:     bucketv1.S3BucketSpec{Versioning: bucketv1.VersioningEnabled},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, group)).To(Succeed())
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: group.Name, Namespace: group.Namespace}}
+
+		By("scaling up")
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, group)).To(Succeed())
+		Expect(group.Status.NextOrdinal).To(Equal(2))
+		buckets, err := listBucketsInBucketGroup(r, ctx, group)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buckets).To(HaveLen(2))
+		for _, bucket := range buckets {
+			owner := metav1.GetControllerOf(&bucket)
+			Expect(owner).NotTo(BeNil())
+			Expect(owner.UID).To(Equal(group.UID))
+			Expect(bucket.Labels).To(HaveKeyWithValue("team", "storage"))
+			Expect(bucket.Labels).To(HaveKeyWithValue(bucketgroupv1.TemplateHashLabel, templateHash(group)))
+			Expect(bucket.Spec.DeletionPolicy).To(Equal(bucketv1.DeletionPolicyRetain))
+			Expect(bucket.Spec.Versioning).To(Equal(bucketv1.VersioningEnabled))
+		}
+
+		By("scaling down and changing the template at once")
+		group.Spec.DesiredBucketCount = 1
+		group.Spec.Template.Spec.Versioning = bucketv1.VersioningSuspended
+		Expect(k8sClient.Update(ctx, group)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, group)).To(Succeed())
+		buckets, err = listBucketsInBucketGroup(r, ctx, group)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buckets).To(HaveLen(1))
+		// The deleted bucket is left out of the rollout
+		Expect(buckets[0].Spec.Versioning).To(Equal(bucketv1.VersioningSuspended))
+		synced := meta.FindStatusCondition(group.Status.Conditions, bucketgroupv1.ConditionSynced)
+		Expect(synced).NotTo(BeNil())
+		Expect(synced.Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("adopts only the S3Buckets annotated for adoption", func() {
+		group := &bucketgroupv1.S3BucketGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "adopting", Namespace: "default"},
+			Spec:       bucketgroupv1.S3BucketGroupSpec{DesiredBucketCount: 2},
+		}
+		Expect(k8sClient.Create(ctx, group)).To(Succeed())
+		for name, annotations := range map[string]map[string]string{
+			"adopting-opted-in":  {bucketgroupv1.AdoptAnnotation: "true"},
+			"adopting-unrelated": nil,
+		} {
+			Expect(k8sClient.Create(ctx, &bucketv1.S3Bucket{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   "default",
+					Labels:      map[string]string{bucketgroupv1.BucketGroupNameLabel: group.Name},
+					Annotations: annotations,
+				},
+				Spec: bucketv1.S3BucketSpec{Phase: bucketv1.PhaseOnline},
+			})).To(Succeed())
+		}
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: group.Name, Namespace: group.Namespace}}
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, group)).To(Succeed())
+
+		bucket := &bucketv1.S3Bucket{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "adopting-opted-in", Namespace: "default"}, bucket)).To(Succeed())
+		Expect(metav1.IsControlledBy(bucket, group)).To(BeTrue())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "adopting-unrelated", Namespace: "default"}, bucket)).To(Succeed())
+		Expect(metav1.GetControllerOf(bucket)).To(BeNil())
+
+		// The S3Bucket left alone doesn't count towards the S3BucketGroup, a new one replaces it
+		buckets, err := listBucketsInBucketGroup(r, ctx, group)
+		Expect(err).NotTo(HaveOccurred())
+		owned := 0
+		for i := range buckets {
+			if metav1.IsControlledBy(&buckets[i], group) {
+				owned++
+			}
+		}
+		Expect(owned).To(Equal(2))
+	})
+})
@@ -0,0 +1,193 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+const (
+	defaultNamingTemplate = "{{.Prefix}}-{{.Ordinal}}-{{.Suffix}}"
+	suffixLength          = 8
+	suffixAlphabet        = "abcdefghijklmnopqrstuvwxyz0123456789"
+	// maxNamingAttempts bounds the number of ordinals skipped because their names are already taken
+	maxNamingAttempts = 100
+)
+
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`)
+
+// bucketNameValues are the values available to the bucket naming template
+type bucketNameValues struct {
+	Prefix    string
+	Group     string
+	Namespace string
+	Ordinal   int
+	Suffix    string
+}
+
+// validateBucketName checks the bucket name against the S3 bucket naming rules
+func validateBucketName(name string) error {
+	if len(name) < 3 || len(name) > 63 {
+		return fmt.Errorf("bucket name %q must be between 3 and 63 characters long", name)
+	}
+	if !bucketNameRegexp.MatchString(name) {
+		return fmt.Errorf("bucket name %q must consist of lowercase letters, numbers, dots and hyphens and start and end with a letter or number", name)
+	}
+	if strings.Contains(name, "..") {
+		return fmt.Errorf("bucket name %q must not contain two adjacent periods", name)
+	}
+	if net.ParseIP(name) != nil {
+		return fmt.Errorf("bucket name %q must not be formatted as an IP address", name)
+	}
+	if strings.HasPrefix(name, "xn--") || strings.HasPrefix(name, "sthree-") ||
+		strings.HasSuffix(name, "-s3alias") || strings.HasSuffix(name, "--ol-s3") {
+		return fmt.Errorf("bucket name %q uses a prefix or suffix reserved by S3", name)
+	}
+	return nil
+}
+
+// generateNameSuffix generates the .Suffix value of the bucket naming template
+func generateNameSuffix(s3BucketGroup *bucketgroupv1.S3BucketGroup) (string, error) {
+	if s3BucketGroup.Spec.Naming.Suffix == bucketgroupv1.NamingSuffixRandom {
+		suffix := make([]byte, suffixLength)
+		for i := range suffix {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(suffixAlphabet))))
+			if err != nil {
+				return "", err
+			}
+			suffix[i] = suffixAlphabet[n.Int64()]
+		}
+		return string(suffix), nil
+	}
+	hash := sha256.Sum256([]byte(s3BucketGroup.Namespace + "/" + s3BucketGroup.Name))
+	return hex.EncodeToString(hash[:])[:suffixLength], nil
+}
+
+// renderBucketName renders the bucket name of the given ordinal from the naming template of the S3BucketGroup
+func renderBucketName(s3BucketGroup *bucketgroupv1.S3BucketGroup, ordinal int) (string, error) {
+	naming := s3BucketGroup.Spec.Naming
+	text := naming.Template
+	if text == "" {
+		text = defaultNamingTemplate
+	}
+	// Names must differ per ordinal and per namespace, S3 bucket names are global
+	if !strings.Contains(text, ".Ordinal") || !(strings.Contains(text, ".Suffix") || strings.Contains(text, ".Namespace")) {
+		return "", fmt.Errorf("naming template %q must use .Ordinal and one of .Suffix or .Namespace", text)
+	}
+	tmpl, err := template.New("bucketName").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid naming template %q: %w", text, err)
+	}
+
+	suffix, err := generateNameSuffix(s3BucketGroup)
+	if err != nil {
+		return "", err
+	}
+	values := bucketNameValues{
+		Prefix:    naming.Prefix,
+		Group:     s3BucketGroup.Name,
+		Namespace: s3BucketGroup.Namespace,
+		Ordinal:   ordinal,
+		Suffix:    suffix,
+	}
+	if values.Prefix == "" {
+		values.Prefix = s3BucketGroup.Name
+	}
+
+	var name strings.Builder
+	if err := tmpl.Execute(&name, values); err != nil {
+		return "", fmt.Errorf("failed to render naming template %q: %w", text, err)
+	}
+	return name.String(), validateBucketName(name.String())
+}
+
+// isBucketNameTaken checks whether an S3Bucket or an s3 bucket with the given name already exists
+func isBucketNameTaken(r *S3BucketGroupReconciler, ctx context.Context, svc *s3.S3, namespace string, bucketName string) (bool, error) {
+	err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: bucketName}, &bucketv1.S3Bucket{})
+	if err == nil {
+		return true, nil
+	}
+	if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	_, err = svc.HeadBucket(&s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err == nil {
+		return true, nil
+	}
+	if aerr, ok := err.(awserr.RequestFailure); ok {
+		switch aerr.StatusCode() {
+		case 404:
+			return false, nil
+		case 403:
+			// The bucket exists but is owned by someone else
+			return true, nil
+		case 301:
+			// The bucket exists in another region
+			return true, nil
+		}
+	}
+	return false, err
+}
+
+// generateNewBucketName creates the next free bucket name of the S3BucketGroup and advances status.NextOrdinal.
+// The caller is responsible for persisting the S3BucketGroup status.
+func generateNewBucketName(r *S3BucketGroupReconciler, ctx context.Context, s3BucketGroup *bucketgroupv1.S3BucketGroup) (string, error) {
+	// The s3 bucket names are checked where the S3Buckets of the group will be created
+	clients, err := r.Clients.ForProvider(ctx, s3BucketGroup.Spec.ProviderConfigRef)
+	if err != nil {
+		return "", err
+	}
+	for attempt := 0; attempt < maxNamingAttempts; attempt++ {
+		bucketName, err := renderBucketName(s3BucketGroup, s3BucketGroup.Status.NextOrdinal)
+		if err != nil {
+			return "", err
+		}
+		s3BucketGroup.Status.NextOrdinal += 1
+
+		isTaken, err := isBucketNameTaken(r, ctx, clients.S3, s3BucketGroup.Namespace, bucketName)
+		if err != nil {
+			return "", err
+		}
+		if !isTaken {
+			return bucketName, nil
+		}
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("Bucket name %s is already taken, skipping", bucketName)))
+	}
+	return "", fmt.Errorf("no free bucket name found after %d attempts", maxNamingAttempts)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+var _ = Describe("S3BucketGroup naming", func() {
+	newGroup := func(namespace string, naming bucketgroupv1.BucketNaming) *bucketgroupv1.S3BucketGroup {
+		return &bucketgroupv1.S3BucketGroup{
+			ObjectMeta: metav1.ObjectMeta{Name: "logs", Namespace: namespace},
+			Spec:       bucketgroupv1.S3BucketGroupSpec{Naming: naming},
+		}
+	}
+
+	DescribeTable("validating bucket names",
+		func(name string, valid bool) {
+			err := validateBucketName(name)
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		Entry("valid", "logs-0-43a60649", true),
+		Entry("valid with periods", "logs.example.com", true),
+		Entry("minimum length", "abc", true),
+		Entry("maximum length", strings.Repeat("a", 63), true),
+		Entry("too short", "ab", false),
+		Entry("too long", strings.Repeat("a", 64), false),
+		Entry("uppercase", "Logs", false),
+		Entry("underscore", "my_logs", false),
+		Entry("leading hyphen", "-logs", false),
+		Entry("trailing period", "logs.", false),
+		Entry("adjacent periods", "my..logs", false),
+		Entry("IP address", "192.168.5.4", false),
+		Entry("xn-- prefix", "xn--logs", false),
+		Entry("sthree- prefix", "sthree-logs", false),
+		Entry("-s3alias suffix", "logs-s3alias", false),
+		Entry("--ol-s3 suffix", "logs--ol-s3", false),
+	)
+
+	Context("generating the name suffix", func() {
+		It("hashes the namespace and name of the group", func() {
+			suffix, err := generateNameSuffix(newGroup("default", bucketgroupv1.BucketNaming{}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(suffix).To(Equal("43a60649"))
+
+			other, err := generateNameSuffix(newGroup("other", bucketgroupv1.BucketNaming{}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other).NotTo(Equal(suffix))
+		})
+
+		It("generates a new random suffix every time", func() {
+			group := newGroup("default", bucketgroupv1.BucketNaming{Suffix: bucketgroupv1.NamingSuffixRandom})
+			first, err := generateNameSuffix(group)
+			Expect(err).NotTo(HaveOccurred())
+			second, err := generateNameSuffix(group)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(first).To(MatchRegexp(`^[a-z0-9]{8}$`))
+			Expect(second).NotTo(Equal(first))
+		})
+	})
+
+	DescribeTable("rendering bucket names",
+		func(namespace string, naming bucketgroupv1.BucketNaming, ordinal int, want string) {
+			name, err := renderBucketName(newGroup(namespace, naming), ordinal)
+			if want == "" {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal(want))
+		},
+		Entry("default template", "default", bucketgroupv1.BucketNaming{}, 3, "logs-3-43a60649"),
+		Entry("prefix", "default", bucketgroupv1.BucketNaming{Prefix: "acme"}, 0, "acme-0-43a60649"),
+		Entry("namespace template", "team-a",
+			bucketgroupv1.BucketNaming{Template: "{{.Group}}-{{.Namespace}}-{{.Ordinal}}"}, 1, "logs-team-a-1"),
+		Entry("template without .Ordinal", "default", bucketgroupv1.BucketNaming{Template: "{{.Prefix}}-{{.Suffix}}"}, 0, ""),
+		Entry("template without .Suffix or .Namespace", "default", bucketgroupv1.BucketNaming{Template: "{{.Prefix}}-{{.Ordinal}}"}, 0, ""),
+		Entry("unknown value", "default", bucketgroupv1.BucketNaming{Template: "{{.Owner}}-{{.Ordinal}}-{{.Suffix}}"}, 0, ""),
+		Entry("invalid bucket name", "default", bucketgroupv1.BucketNaming{Prefix: "Logs"}, 0, ""),
+	)
+})
@@ -0,0 +1,129 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+// isS3BucketEmpty checks whether the S3 bucket with the given bucket name holds no objects, versions or delete markers
+func isS3BucketEmpty(svc *s3.S3, bucketName string) (bool, error) {
+	result, err := svc.ListObjectVersions(&s3.ListObjectVersionsInput{
+		Bucket:  aws.String(bucketName),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(result.Versions) == 0 && len(result.DeleteMarkers) == 0, nil
+}
+
+// isBucketEmpty checks whether the s3 bucket of the S3Bucket is empty, using the clients of its S3ProviderConfig and region
+func isBucketEmpty(r *S3BucketGroupReconciler, ctx context.Context, bucket bucketv1.S3Bucket) (bool, error) {
+	clients, err := r.Clients.ForProvider(ctx, bucket.Spec.ProviderConfigRef)
+	if err != nil {
+		return false, err
+	}
+	region := bucket.Status.Region
+	if region == "" {
+		region = bucket.Spec.Region
+	}
+	return isS3BucketEmpty(clients.ForRegion(region).S3, bucket.Name)
+}
+
+// selectBucketsForScaleDown orders the buckets according to the scale down policy and returns the first count of them
+func selectBucketsForScaleDown(r *S3BucketGroupReconciler, ctx context.Context, policy bucketgroupv1.ScaleDownPolicy, buckets []bucketv1.S3Bucket, count int) []bucketv1.S3Bucket {
+	// Buckets matching the policy are removed first, ties are broken by age
+	preferred := make(map[string]bool, len(buckets))
+	for _, bucket := range buckets {
+		switch policy {
+		case bucketgroupv1.ScaleDownAnnotatedFirst:
+			preferred[bucket.Name] = bucket.Annotations[bucketgroupv1.DeleteCandidateAnnotation] == "true"
+		case bucketgroupv1.ScaleDownEmptyFirst:
+			isEmpty, err := isBucketEmpty(r, ctx, bucket)
+			if err != nil {
+				log.Log.Error(err, colorCodeMessage(fmt.Sprintf("failed to check if bucket %s is empty", bucket.Name)))
+			}
+			preferred[bucket.Name] = isEmpty
+		}
+	}
+
+	candidates := append([]bucketv1.S3Bucket{}, buckets...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if preferred[a.Name] != preferred[b.Name] {
+			return preferred[a.Name]
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			if policy == bucketgroupv1.ScaleDownOldestFirst {
+				return a.CreationTimestamp.Before(&b.CreationTimestamp)
+			}
+			return b.CreationTimestamp.Before(&a.CreationTimestamp)
+		}
+		return a.Name > b.Name
+	})
+
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	return candidates[:count]
+}
+
+// scaleDownBuckets deletes the surplus S3Buckets of the S3BucketGroup and returns the buckets that are left.
+// The backing s3 buckets are handled by the S3Bucket finalizer, which honors each bucket's deletion policy.
+func scaleDownBuckets(r *S3BucketGroupReconciler, ctx context.Context, s3BucketGroup *bucketgroupv1.S3BucketGroup, buckets []bucketv1.S3Bucket) ([]bucketv1.S3Bucket, error) {
+	surplus := len(buckets) - s3BucketGroup.Spec.DesiredBucketCount
+	victims := selectBucketsForScaleDown(r, ctx, s3BucketGroup.Spec.ScaleDownPolicy, buckets, surplus)
+	deleted := map[string]bool{}
+	var err error
+	for i := range victims {
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("Scaling down, deleting bucket %s (deletion policy: %s)",
+			victims[i].Name, victims[i].Spec.DeletionPolicy)))
+		if err = r.Client.Delete(ctx, &victims[i]); err != nil {
+			break
+		}
+		deleted[victims[i].Name] = true
+	}
+
+	remaining := []bucketv1.S3Bucket{}
+	for _, bucket := range buckets {
+		if !deleted[bucket.Name] {
+			remaining = append(remaining, bucket)
+		}
+	}
+	return remaining, err
+}
+
+// activeBuckets filters out the buckets that are already being deleted
+func activeBuckets(buckets []bucketv1.S3Bucket) []bucketv1.S3Bucket {
+	active := []bucketv1.S3Bucket{}
+	for _, bucket := range buckets {
+		if bucket.DeletionTimestamp.IsZero() {
+			active = append(active, bucket)
+		}
+	}
+	return active
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+var _ = Describe("S3BucketGroup scale down", func() {
+	created := time.Date(2023, 9, 19, 10, 0, 0, 0, time.UTC)
+	newBucket := func(name string, age time.Duration, annotated bool) bucketv1.S3Bucket {
+		bucket := bucketv1.S3Bucket{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created.Add(-age)),
+		}}
+		if annotated {
+			bucket.Annotations = map[string]string{bucketgroupv1.DeleteCandidateAnnotation: "true"}
+		}
+		return bucket
+	}
+	buckets := []bucketv1.S3Bucket{
+		newBucket("middle", 2*time.Hour, true),
+		newBucket("oldest", 3*time.Hour, false),
+		newBucket("newest", time.Hour, false),
+		newBucket("newest-twin", time.Hour, false),
+	}
+
+	DescribeTable("selecting the buckets to remove",
+		func(policy bucketgroupv1.ScaleDownPolicy, count int, want []string) {
+			selected := selectBucketsForScaleDown(nil, context.Background(), policy, buckets, count)
+			names := []string{}
+			for _, bucket := range selected {
+				names = append(names, bucket.Name)
+			}
+			Expect(names).To(Equal(want))
+		},
+		Entry("newest first", bucketgroupv1.ScaleDownNewestFirst, 2, []string{"newest-twin", "newest"}),
+		Entry("newest first by default", bucketgroupv1.ScaleDownPolicy(""), 1, []string{"newest-twin"}),
+		Entry("oldest first", bucketgroupv1.ScaleDownOldestFirst, 2, []string{"oldest", "middle"}),
+		Entry("annotated first, then newest", bucketgroupv1.ScaleDownAnnotatedFirst, 2, []string{"middle", "newest-twin"}),
+		Entry("none", bucketgroupv1.ScaleDownNewestFirst, 0, []string{}),
+		Entry("more than available", bucketgroupv1.ScaleDownOldestFirst, 5, []string{"oldest", "middle", "newest-twin", "newest"}),
+	)
+
+	It("leaves the buckets being deleted out of the active buckets", func() {
+		deleting := newBucket("deleting", time.Hour, false)
+		deleting.DeletionTimestamp = &metav1.Time{Time: created}
+		active := activeBuckets([]bucketv1.S3Bucket{buckets[0], deleting})
+		Expect(active).To(HaveLen(1))
+		Expect(active[0].Name).To(Equal("middle"))
+	})
+})
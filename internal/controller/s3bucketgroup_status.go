@@ -0,0 +1,114 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+// Reasons for the conditions of S3BucketGroup
+const (
+	ReasonBucketsReady     = "BucketsReady"
+	ReasonScalingUp        = "ScalingUp"
+	ReasonScalingDown      = "ScalingDown"
+	ReasonRollingOut       = "RollingOut"
+	ReasonBucketsNotReady  = "BucketsNotReady"
+	ReasonReconcileSuccess = "ReconcileSuccess"
+	ReasonReconcileError   = "ReconcileError"
+	ReasonBucketsDegraded  = "BucketsDegraded"
+	ReasonHealthy          = "Healthy"
+)
+
+var conditionReasonRegexp = regexp.MustCompile(`^[A-Za-z]([A-Za-z0-9_,:]*[A-Za-z0-9_])?$`)
+
+// errorReason returns the AWS error code of the error (e.g. AccessDenied) as condition reason, or fallback otherwise
+func errorReason(err error, fallback string) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && conditionReasonRegexp.MatchString(aerr.Code()) {
+		return aerr.Code()
+	}
+	return fallback
+}
+
+// setGroupCondition sets the condition on the status of the S3BucketGroup for its current generation
+func setGroupCondition(s3BucketGroup *bucketgroupv1.S3BucketGroup, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&s3BucketGroup.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: s3BucketGroup.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setGroupSynced records the outcome of the last reconcile of the S3BucketGroup.
+// The generation is only observed once it is reconciled successfully.
+func setGroupSynced(s3BucketGroup *bucketgroupv1.S3BucketGroup, syncErr error) {
+	if syncErr != nil {
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionSynced, metav1.ConditionFalse,
+			errorReason(syncErr, ReasonReconcileError), syncErr.Error())
+		return
+	}
+	s3BucketGroup.Status.ObservedGeneration = s3BucketGroup.Generation
+	setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionSynced, metav1.ConditionTrue, ReasonReconcileSuccess, "")
+}
+
+// setGroupBucketConditions sets the Ready and Degraded conditions of the S3BucketGroup from its S3Buckets
+func setGroupBucketConditions(s3BucketGroup *bucketgroupv1.S3BucketGroup, buckets []bucketv1.S3Bucket) {
+	desired := s3BucketGroup.Spec.DesiredBucketCount
+	status := s3BucketGroup.Status
+	switch {
+	case len(buckets) < desired:
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionReady, metav1.ConditionFalse, ReasonScalingUp,
+			fmt.Sprintf("%d of %d buckets created", len(buckets), desired))
+	case len(buckets) > desired:
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionReady, metav1.ConditionFalse, ReasonScalingDown,
+			fmt.Sprintf("%d buckets to remove", len(buckets)-desired))
+	case status.UpdatedBuckets < len(buckets):
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionReady, metav1.ConditionFalse, ReasonRollingOut,
+			fmt.Sprintf("%d of %d buckets updated", status.UpdatedBuckets, len(buckets)))
+	case status.ReadyBuckets < desired:
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionReady, metav1.ConditionFalse, ReasonBucketsNotReady,
+			fmt.Sprintf("%d of %d buckets ready", status.ReadyBuckets, desired))
+	default:
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionReady, metav1.ConditionTrue, ReasonBucketsReady, "")
+	}
+
+	degraded := []string{}
+	for i := range buckets {
+		if meta.IsStatusConditionTrue(buckets[i].Status.Conditions, bucketv1.ConditionDegraded) ||
+			meta.IsStatusConditionFalse(buckets[i].Status.Conditions, bucketv1.ConditionSynced) {
+			degraded = append(degraded, buckets[i].Name)
+		}
+	}
+	if len(degraded) > 0 {
+		setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionDegraded, metav1.ConditionTrue, ReasonBucketsDegraded,
+			fmt.Sprintf("degraded or failing buckets: %s", strings.Join(degraded, ", ")))
+		return
+	}
+	setGroupCondition(s3BucketGroup, bucketgroupv1.ConditionDegraded, metav1.ConditionFalse, ReasonHealthy, "")
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+var _ = Describe("S3BucketGroup status", func() {
+	DescribeTable("setting the Synced condition",
+		func(syncErr error, wantStatus metav1.ConditionStatus, wantObservedGeneration int64) {
+			s3BucketGroup := &bucketgroupv1.S3BucketGroup{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Status:     bucketgroupv1.S3BucketGroupStatus{ObservedGeneration: 1},
+			}
+			setGroupSynced(s3BucketGroup, syncErr)
+			Expect(s3BucketGroup.Status.ObservedGeneration).To(Equal(wantObservedGeneration))
+			synced := meta.FindStatusCondition(s3BucketGroup.Status.Conditions, bucketgroupv1.ConditionSynced)
+			Expect(synced).NotTo(BeNil())
+			Expect(synced.Status).To(Equal(wantStatus))
+		},
+		Entry("success observes the generation", nil, metav1.ConditionTrue, int64(2)),
+		Entry("error keeps the observed generation", errors.New("boom"), metav1.ConditionFalse, int64(1)),
+	)
+})
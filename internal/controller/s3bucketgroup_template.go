@@ -0,0 +1,157 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+// bucketSpecFromTemplate returns the S3Bucket spec described by the template of the S3BucketGroup
+func bucketSpecFromTemplate(bucketGroup *bucketgroupv1.S3BucketGroup) bucketv1.S3BucketSpec {
+	spec := *bucketGroup.Spec.Template.Spec.DeepCopy()
+	if spec.Phase == "" {
+		spec.Phase = bucketv1.PhaseOnline
+	}
+	if spec.DeletionPolicy == "" {
+		spec.DeletionPolicy = bucketGroup.Spec.DeletionPolicy
+	}
+	if spec.ProviderConfigRef == "" {
+		spec.ProviderConfigRef = bucketGroup.Spec.ProviderConfigRef
+	}
+	return spec
+}
+
+// applyBucketTemplate stamps the template of the S3BucketGroup onto the S3Bucket.
+// Labels and annotations that are not part of the template are kept.
+func applyBucketTemplate(bucket *bucketv1.S3Bucket, bucketGroup *bucketgroupv1.S3BucketGroup) {
+	template := bucketGroup.Spec.Template
+	if bucket.Labels == nil {
+		bucket.Labels = map[string]string{}
+	}
+	for key, value := range template.Metadata.Labels {
+		bucket.Labels[key] = value
+	}
+	// The group label cannot be overridden by the template, it is used to list the buckets of the group
+	bucket.Labels[bucketgroupv1.BucketGroupNameLabel] = bucketGroup.Name
+
+	if len(template.Metadata.Annotations) > 0 && bucket.Annotations == nil {
+		bucket.Annotations = map[string]string{}
+	}
+	for key, value := range template.Metadata.Annotations {
+		bucket.Annotations[key] = value
+	}
+
+	bucket.Labels[bucketgroupv1.TemplateHashLabel] = templateHash(bucketGroup)
+
+	bucket.Spec = bucketSpecFromTemplate(bucketGroup)
+}
+
+// templateHash computes a hash of the bucket template of the S3BucketGroup, including the defaulted values
+func templateHash(bucketGroup *bucketgroupv1.S3BucketGroup) string {
+	template := bucketgroupv1.S3BucketTemplate{
+		Metadata: bucketGroup.Spec.Template.Metadata,
+		Spec:     bucketSpecFromTemplate(bucketGroup),
+	}
+	// Marshalling a struct is deterministic, map keys are sorted
+	data, _ := json.Marshal(template)
+	hasher := fnv.New32a()
+	hasher.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// isBucketReady checks whether the S3Bucket reached its desired phase for its current spec
+func isBucketReady(bucket *bucketv1.S3Bucket) bool {
+	return bucket.Status.ObservedGeneration == bucket.Generation && bucket.Status.Phase == bucket.Spec.Phase
+}
+
+// maxUnavailableBuckets resolves the maxUnavailable setting of the S3BucketGroup to a number of buckets
+func maxUnavailableBuckets(bucketGroup *bucketgroupv1.S3BucketGroup) int {
+	maxUnavailable := intstr.FromInt(1)
+	if bucketGroup.Spec.MaxUnavailable != nil {
+		maxUnavailable = *bucketGroup.Spec.MaxUnavailable
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, bucketGroup.Spec.DesiredBucketCount, false)
+	if err != nil {
+		log.Log.Error(err, colorCodeMessage("invalid maxUnavailable, defaulting to 1"), "Bucket Group", bucketGroup.Name)
+		return 1
+	}
+	// Always allow progress, even for small groups and percentages rounding down to 0
+	if value < 1 {
+		value = 1
+	}
+	return value
+}
+
+// rolloutBucketTemplate updates the S3Buckets that don't match the current template of the S3BucketGroup.
+// Unready outdated buckets are updated right away, ready ones only while fewer than maxUnavailable buckets are unready.
+// Buckets being deleted are skipped, their spec must not change mid-deletion.
+// Updates status.UpdatedBuckets and status.ReadyBuckets, the caller is responsible for persisting the status.
+func rolloutBucketTemplate(r *S3BucketGroupReconciler, ctx context.Context, bucketGroup *bucketgroupv1.S3BucketGroup, buckets []bucketv1.S3Bucket) error {
+	buckets = activeBuckets(buckets)
+	hash := templateHash(bucketGroup)
+	updated, ready := 0, 0
+	outdated := []*bucketv1.S3Bucket{}
+	for i := range buckets {
+		if buckets[i].Labels[bucketgroupv1.TemplateHashLabel] == hash {
+			updated++
+		} else {
+			outdated = append(outdated, &buckets[i])
+		}
+		if isBucketReady(&buckets[i]) {
+			ready++
+		}
+	}
+	bucketGroup.Status.UpdatedBuckets = updated
+	bucketGroup.Status.ReadyBuckets = ready
+	if len(outdated) == 0 {
+		return nil
+	}
+
+	// Update unready buckets first, they don't reduce the number of available buckets
+	sort.SliceStable(outdated, func(i, j int) bool {
+		return !isBucketReady(outdated[i]) && isBucketReady(outdated[j])
+	})
+	budget := maxUnavailableBuckets(bucketGroup) - (len(buckets) - ready)
+	for _, bucket := range outdated {
+		isReady := isBucketReady(bucket)
+		if isReady && budget <= 0 {
+			break
+		}
+		log.Log.Info(colorCodeMessage(fmt.Sprintf("Rolling out template %s to bucket %s", hash, bucket.Name)))
+		applyBucketTemplate(bucket, bucketGroup)
+		if err := r.Client.Update(ctx, bucket); err != nil {
+			return err
+		}
+		bucketGroup.Status.UpdatedBuckets++
+		if isReady {
+			budget--
+			bucketGroup.Status.ReadyBuckets--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+	bucketgroupv1 "art-of-infrastructure-management/api/v1"
+)
+
+var _ = Describe("S3BucketGroup template", func() {
+	newGroup := func(mutate func(*bucketgroupv1.S3BucketGroup)) *bucketgroupv1.S3BucketGroup {
+		group := &bucketgroupv1.S3BucketGroup{
+			Spec: bucketgroupv1.S3BucketGroupSpec{
+				DesiredBucketCount: 2,
+				DeletionPolicy:     bucketv1.DeletionPolicyRetain,
+				Template: bucketgroupv1.S3BucketTemplate{
+					Metadata: bucketgroupv1.S3BucketTemplateMeta{Labels: map[string]string{"team": "a"}},
+				},
+			},
+		}
+		if mutate != nil {
+			mutate(group)
+		}
+		return group
+	}
+
+	DescribeTable("hashing the template",
+		func(mutate func(*bucketgroupv1.S3BucketGroup), changed bool) {
+			hash := templateHash(newGroup(mutate))
+			if changed {
+				Expect(hash).NotTo(Equal(templateHash(newGroup(nil))))
+			} else {
+				Expect(hash).To(Equal(templateHash(newGroup(nil))))
+			}
+		},
+		Entry("same template", nil, false),
+		Entry("bucket count", func(group *bucketgroupv1.S3BucketGroup) { group.Spec.DesiredBucketCount = 5 }, false),
+		Entry("explicit default phase", func(group *bucketgroupv1.S3BucketGroup) {
+			group.Spec.Template.Spec.Phase = bucketv1.PhaseOnline
+		}, false),
+		Entry("labels", func(group *bucketgroupv1.S3BucketGroup) { group.Spec.Template.Metadata.Labels["team"] = "b" }, true),
+		Entry("spec", func(group *bucketgroupv1.S3BucketGroup) { group.Spec.Template.Spec.Phase = bucketv1.PhaseOffline }, true),
+		Entry("defaulted deletion policy", func(group *bucketgroupv1.S3BucketGroup) {
+			group.Spec.DeletionPolicy = bucketv1.DeletionPolicyDelete
+		}, true),
+	)
+
+	DescribeTable("resolving maxUnavailable",
+		func(maxUnavailable *intstr.IntOrString, desired int, want int) {
+			group := &bucketgroupv1.S3BucketGroup{
+				Spec: bucketgroupv1.S3BucketGroupSpec{DesiredBucketCount: desired, MaxUnavailable: maxUnavailable},
+			}
+			Expect(maxUnavailableBuckets(group)).To(Equal(want))
+		},
+		Entry("default", nil, 10, 1),
+		Entry("absolute", &intstr.IntOrString{Type: intstr.Int, IntVal: 3}, 10, 3),
+		Entry("percentage", &intstr.IntOrString{Type: intstr.String, StrVal: "30%"}, 10, 3),
+		Entry("percentage rounding down", &intstr.IntOrString{Type: intstr.String, StrVal: "25%"}, 10, 2),
+		Entry("at least one", &intstr.IntOrString{Type: intstr.String, StrVal: "10%"}, 2, 1),
+		Entry("invalid", &intstr.IntOrString{Type: intstr.String, StrVal: "many"}, 10, 1),
+	)
+})
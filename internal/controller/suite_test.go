@@ -30,6 +30,7 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
 	bucketgroupv1 "art-of-infrastructure-management/api/v1"
 	//+kubebuilder:scaffold:imports
 )
@@ -65,6 +66,9 @@ var _ = BeforeSuite(func() {
 	err = bucketgroupv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = bucketv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
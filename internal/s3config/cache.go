@@ -0,0 +1,212 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sts"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bucketv1 "art-of-infrastructure-management/api/bucket/v1"
+)
+
+// Clients are the clients of the AWS services the operator uses, sharing one session
+type Clients struct {
+	S3  *s3.S3
+	IAM *iam.IAM
+	SQS *sqs.SQS
+	STS *sts.STS
+
+	session  *session.Session
+	mu       sync.Mutex
+	regions  map[string]*Clients
+	identity *sts.GetCallerIdentityOutput
+}
+
+// NewClients creates the clients of the AWS services from the session
+func NewClients(sess *session.Session) *Clients {
+	return &Clients{
+		S3:      s3.New(sess),
+		IAM:     iam.New(sess),
+		SQS:     sqs.New(sess),
+		STS:     sts.New(sess),
+		session: sess,
+		regions: map[string]*Clients{},
+	}
+}
+
+// Region returns the region the clients send their requests to
+func (c *Clients) Region() string {
+	return aws.StringValue(c.session.Config.Region)
+}
+
+// callerIdentity returns the identity the clients authenticate as
+func (c *Clients) callerIdentity() (*sts.GetCallerIdentityOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.identity != nil {
+		return c.identity, nil
+	}
+	result, err := c.STS.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	c.identity = result
+	return c.identity, nil
+}
+
+// CallerUserID returns the unique ID of the identity the clients authenticate as, aws:userid in policies
+func (c *Clients) CallerUserID() (string, error) {
+	identity, err := c.callerIdentity()
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(identity.UserId), nil
+}
+
+// CallerAccount returns the ID of the AWS account the clients authenticate in
+func (c *Clients) CallerAccount() (string, error) {
+	identity, err := c.callerIdentity()
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(identity.Account), nil
+}
+
+// ForRegion returns the clients for the given region, sharing the endpoint and credentials of these clients.
+// The clients themselves are returned when region is empty or their own region.
+func (c *Clients) ForRegion(region string) *Clients {
+	if region == "" || region == c.Region() {
+		return c
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if clients, ok := c.regions[region]; ok {
+		return clients
+	}
+	clients := NewClients(c.session.Copy(&aws.Config{Region: aws.String(region)}))
+	c.regions[region] = clients
+	return clients
+}
+
+// cachedClients are the clients of an S3ProviderConfig, built for a version of the S3ProviderConfig and its Secret
+type cachedClients struct {
+	version string
+	clients *Clients
+}
+
+// ClientCache hands out the clients of S3ProviderConfigs, building them again when the S3ProviderConfig
+// or its credentials Secret change
+type ClientCache struct {
+	reader   client.Reader
+	secrets  client.Reader
+	defaults *Clients
+
+	mu      sync.Mutex
+	clients map[string]cachedClients
+}
+
+// NewClientCache creates a client cache, defaults are used for S3Buckets without S3ProviderConfig.
+// S3ProviderConfigs are read with reader, their credentials Secrets with secrets.
+func NewClientCache(reader client.Reader, secrets client.Reader, defaults *Clients) *ClientCache {
+	return &ClientCache{
+		reader:   reader,
+		secrets:  secrets,
+		defaults: defaults,
+		clients:  map[string]cachedClients{},
+	}
+}
+
+// ForProvider returns the clients of the S3ProviderConfig with the given name, the default clients when name is empty
+func (c *ClientCache) ForProvider(ctx context.Context, name string) (*Clients, error) {
+	if name == "" {
+		return c.defaults, nil
+	}
+
+	providerConfig := &bucketv1.S3ProviderConfig{}
+	if err := c.reader.Get(ctx, types.NamespacedName{Name: name}, providerConfig); err != nil {
+		return nil, fmt.Errorf("failed to get S3ProviderConfig %s: %w", name, err)
+	}
+	version := providerConfig.ResourceVersion
+	var secret *corev1.Secret
+	if ref := providerConfig.Spec.CredentialsSecretRef; ref != nil {
+		secret = &corev1.Secret{}
+		if err := c.secrets.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get credentials secret of S3ProviderConfig %s: %w", name, err)
+		}
+		version += "/" + secret.ResourceVersion
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.clients[name]; ok && cached.version == version {
+		return cached.clients, nil
+	}
+	clients, err := newProviderClients(providerConfig, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clients of S3ProviderConfig %s: %w", name, err)
+	}
+	c.clients[name] = cachedClients{version: version, clients: clients}
+	return clients, nil
+}
+
+// newProviderClients builds the clients of the S3ProviderConfig, assuming its role if any.
+// The S3ProviderConfig gets the same defaults as the settings of the operator.
+func newProviderClients(providerConfig *bucketv1.S3ProviderConfig, secret *corev1.Secret) (*Clients, error) {
+	spec := providerConfig.Spec
+	config := Config{
+		Endpoint:           spec.Endpoint,
+		Region:             spec.Region,
+		ForcePathStyle:     spec.ForcePathStyle,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+		caBundleData:       spec.CABundle,
+	}
+	config.applyDefaults()
+	var creds *credentials.Credentials
+	if secret != nil {
+		var err error
+		if creds, err = credentialsFromSecret(secret); err != nil {
+			return nil, err
+		}
+	}
+	sess, err := config.NewSession(creds)
+	if err != nil {
+		return nil, err
+	}
+	if spec.AssumeRoleARN != "" {
+		roleCreds := stscreds.NewCredentials(sess, spec.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if spec.ExternalID != "" {
+				p.ExternalID = aws.String(spec.ExternalID)
+			}
+		})
+		sess = sess.Copy(&aws.Config{Credentials: roleCreds})
+	}
+	return NewClients(sess), nil
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package s3config loads the settings the operator connects to S3 with and builds AWS sessions from them.
+package s3config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Keys of the credentials in a credentials Secret, matching the AWS environment variables
+const (
+	AccessKeyIDKey     = "AWS_ACCESS_KEY_ID"
+	SecretAccessKeyKey = "AWS_SECRET_ACCESS_KEY"
+	SessionTokenKey    = "AWS_SESSION_TOKEN"
+)
+
+// Defaults of the operator, it connects to LocalStack unless an endpoint is configured
+const (
+	LocalStackEndpoint = "http://localhost:4566"
+	LocalStackRegion   = "us-west-1"
+
+	// AWSEndpoint selects the AWS endpoints, it has to be set explicitly
+	AWSEndpoint = "aws"
+)
+
+// Config describes how the operator connects to S3.
+// Settings are read from a config file, then environment variables, then flags, the last one set wins.
+type Config struct {
+	// Endpoint of S3 and the other AWS services used by the operator, "aws" for the AWS endpoints.
+	// Load defaults it to LocalStack.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Region of the S3 client, from the standard AWS configuration when empty
+	Region string `json:"region,omitempty"`
+
+	// ForcePathStyle addresses buckets as <endpoint>/<bucket> instead of <bucket>.<endpoint>, as needed by most S3 compatible stores.
+	// Load defaults it to true for LocalStack when it is not set.
+	ForcePathStyle *bool `json:"forcePathStyle,omitempty"`
+
+	// CABundle is the path of a PEM file with additional CAs trusted for the endpoint
+	CABundle string `json:"caBundle,omitempty"`
+
+	// InsecureSkipVerify disables the verification of the TLS certificate of the endpoint
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// CredentialsSecret is the <namespace>/<name> of a Secret holding the credentials, the standard AWS chain is used when empty
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+
+	// caBundleData holds additional CAs trusted for the endpoint in PEM format, as given by S3ProviderConfigs
+	caBundleData []byte
+}
+
+// Options binds the settings to flags and loads them
+type Options struct {
+	file           string
+	flags          Config
+	forcePathStyle bool
+}
+
+// BindFlags registers the flags of the S3 settings
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.file, "s3-config", "", "Path of a YAML or JSON file with the S3 settings.")
+	fs.StringVar(&o.flags.Endpoint, "s3-endpoint", "", "The endpoint of S3, \"aws\" for the AWS endpoints. Defaults to LocalStack ("+LocalStackEndpoint+").")
+	fs.StringVar(&o.flags.Region, "s3-region", "", "The region of the S3 client.")
+	fs.BoolVar(&o.forcePathStyle, "s3-force-path-style", false, "Use path-style addressing of S3 buckets.")
+	fs.StringVar(&o.flags.CABundle, "s3-ca-bundle", "", "Path of a PEM file with additional CAs trusted for the S3 endpoint.")
+	fs.BoolVar(&o.flags.InsecureSkipVerify, "s3-insecure-skip-verify", false, "Skip the verification of the TLS certificate of the S3 endpoint.")
+	fs.StringVar(&o.flags.CredentialsSecret, "s3-credentials-secret", "", "The <namespace>/<name> of a Secret holding the S3 credentials.")
+}
+
+// Load merges the config file, the environment variables and the flags set on the command line
+func (o *Options) Load(fs *flag.FlagSet) (Config, error) {
+	config := Config{}
+	file := o.file
+	if file == "" {
+		file = os.Getenv("S3_CONFIG")
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return config, fmt.Errorf("failed to read s3 config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, &config); err != nil {
+			return config, fmt.Errorf("failed to parse s3 config file: %w", err)
+		}
+	}
+
+	if err := applyEnv(&config); err != nil {
+		return config, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "s3-endpoint":
+			config.Endpoint = o.flags.Endpoint
+		case "s3-region":
+			config.Region = o.flags.Region
+		case "s3-force-path-style":
+			config.ForcePathStyle = aws.Bool(o.forcePathStyle)
+		case "s3-ca-bundle":
+			config.CABundle = o.flags.CABundle
+		case "s3-insecure-skip-verify":
+			config.InsecureSkipVerify = o.flags.InsecureSkipVerify
+		case "s3-credentials-secret":
+			config.CredentialsSecret = o.flags.CredentialsSecret
+		}
+	})
+	config.applyDefaults()
+	return config, nil
+}
+
+// applyDefaults points the config to LocalStack when no endpoint is configured,
+// keeping the addressing style and region that were set explicitly
+func (c *Config) applyDefaults() {
+	if c.Endpoint != "" {
+		return
+	}
+	c.Endpoint = LocalStackEndpoint
+	if c.ForcePathStyle == nil {
+		c.ForcePathStyle = aws.Bool(true)
+	}
+	if c.Region == "" {
+		c.Region = LocalStackRegion
+	}
+}
+
+// IsAWS checks whether the config connects to the AWS endpoints
+func (c Config) IsAWS() bool {
+	return c.Endpoint == "" || c.Endpoint == AWSEndpoint
+}
+
+// applyEnv overrides the settings with the environment variables that are set
+func applyEnv(config *Config) error {
+	for _, name := range []string{"AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_S3", "S3_ENDPOINT"} {
+		if value := os.Getenv(name); value != "" {
+			config.Endpoint = value
+		}
+	}
+	for _, name := range []string{"AWS_DEFAULT_REGION", "AWS_REGION"} {
+		if value := os.Getenv(name); value != "" {
+			config.Region = value
+		}
+	}
+	if value := os.Getenv("AWS_CA_BUNDLE"); value != "" {
+		config.CABundle = value
+	}
+	if value := os.Getenv("S3_CREDENTIALS_SECRET"); value != "" {
+		config.CredentialsSecret = value
+	}
+	forcePathStyle, err := boolEnv("S3_FORCE_PATH_STYLE")
+	if err != nil {
+		return err
+	}
+	if forcePathStyle != nil {
+		config.ForcePathStyle = forcePathStyle
+	}
+	insecureSkipVerify, err := boolEnv("S3_INSECURE_SKIP_VERIFY")
+	if err != nil {
+		return err
+	}
+	if insecureSkipVerify != nil {
+		config.InsecureSkipVerify = *insecureSkipVerify
+	}
+	return nil
+}
+
+// boolEnv parses the boolean environment variable, nil when it is not set
+func boolEnv(name string) (*bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of %s: %w", name, err)
+	}
+	return &parsed, nil
+}
+
+// SecretCredentials reads static credentials from the Secret with the given name
+func SecretCredentials(ctx context.Context, reader client.Reader, key types.NamespacedName) (*credentials.Credentials, error) {
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("failed to get credentials secret %s: %w", key, err)
+	}
+	return credentialsFromSecret(secret)
+}
+
+// credentialsFromSecret builds static credentials from the keys of the Secret
+func credentialsFromSecret(secret *corev1.Secret) (*credentials.Credentials, error) {
+	accessKeyID, secretAccessKey := string(secret.Data[AccessKeyIDKey]), string(secret.Data[SecretAccessKeyKey])
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("credentials secret %s/%s needs the keys %s and %s",
+			secret.Namespace, secret.Name, AccessKeyIDKey, SecretAccessKeyKey)
+	}
+	return credentials.NewStaticCredentials(accessKeyID, secretAccessKey, string(secret.Data[SessionTokenKey])), nil
+}
+
+// ParseSecretName parses a <namespace>/<name> Secret reference
+func ParseSecretName(name string) (types.NamespacedName, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid secret %q, expected <namespace>/<name>", name)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// Credentials resolves the credentials of the config, nil for the standard AWS chain
+func (c Config) Credentials(ctx context.Context, reader client.Reader) (*credentials.Credentials, error) {
+	if c.CredentialsSecret == "" {
+		return nil, nil
+	}
+	key, err := ParseSecretName(c.CredentialsSecret)
+	if err != nil {
+		return nil, err
+	}
+	return SecretCredentials(ctx, reader, key)
+}
+
+// httpClient builds the HTTP client trusting the CA bundle, nil when the default client will do
+func (c Config) httpClient() (*http.Client, error) {
+	if c.CABundle == "" && len(c.caBundleData) == 0 && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	pem, source := c.caBundleData, "caBundle"
+	if c.CABundle != "" {
+		var err error
+		if pem, err = os.ReadFile(c.CABundle); err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		source = c.CABundle
+	}
+	if len(pem) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", source)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// NewSession builds an AWS session from the config, using the credentials when not nil
+func (c Config) NewSession(creds *credentials.Credentials) (*session.Session, error) {
+	awsConfig := aws.NewConfig().WithS3ForcePathStyle(aws.BoolValue(c.ForcePathStyle))
+	if !c.IsAWS() {
+		awsConfig = awsConfig.WithEndpoint(c.Endpoint)
+	}
+	if c.Region != "" {
+		awsConfig = awsConfig.WithRegion(c.Region)
+	}
+	if creds != nil {
+		awsConfig = awsConfig.WithCredentials(creds)
+	}
+	httpClient, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		awsConfig = awsConfig.WithHTTPClient(httpClient)
+	}
+	return session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}